@@ -0,0 +1,10 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package main
+
+import (
+	"github.com/erinacio/sha256s/engine"
+)
+
+func watchRateSignals(total, file *engine.RateLimiter) {}
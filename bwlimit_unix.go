@@ -0,0 +1,45 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package main
+
+import (
+	"log"
+	"math"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/erinacio/sha256s/engine"
+)
+
+// watchRateSignals halves the rates of the total and per-file limiters, which
+// may be nil, on SIGUSR1, and doubles them on SIGUSR2.
+func watchRateSignals(total, file *engine.RateLimiter) {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGUSR1, syscall.SIGUSR2)
+	go func() {
+		for sig := range sigCh {
+			var limits []string
+			for _, l := range []*engine.RateLimiter{total, file} {
+				if l == nil {
+					continue
+				}
+				rate := l.Rate()
+				if sig == syscall.SIGUSR1 && rate > 1 {
+					rate /= 2
+				} else if sig == syscall.SIGUSR2 && rate <= math.MaxInt64/2 {
+					rate *= 2
+				}
+				l.SetRate(rate)
+				limit := formatSize(rate) + "/s"
+				if l == file {
+					limit += " per file"
+				}
+				limits = append(limits, limit)
+			}
+			log.Printf("bandwidth limit is %s", strings.Join(limits, ", "))
+		}
+	}()
+}
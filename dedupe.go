@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+const (
+	DedupeHardlink = "hardlink"
+	DedupeReflink  = "reflink"
+)
+
+// replaceDuplicate replaces dup with a hard link or a reflink to keep, after
+// making sure that their contents are the same byte for byte.  The new file
+// is renamed over dup, so dup is left untouched on failure.
+func replaceDuplicate(method, keep, dup string) (err error) {
+	info, err := os.Stat(dup)
+	if err != nil {
+		return
+	}
+	same, err := sameContent(keep, dup)
+	if err != nil {
+		return
+	}
+	if !same {
+		return fmt.Errorf("%s: content differs from %s, not replaced", dup, keep)
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(dup), "."+filepath.Base(dup)+".*")
+	if err != nil {
+		return
+	}
+	_ = tmp.Close()
+	if err = os.Remove(tmp.Name()); err != nil {
+		return
+	}
+	switch method {
+	case DedupeHardlink:
+		err = os.Link(keep, tmp.Name())
+	case DedupeReflink:
+		if err = reflink(keep, tmp.Name()); err == nil {
+			err = os.Chmod(tmp.Name(), info.Mode().Perm())
+		}
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), dup)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return &os.PathError{Op: method, Path: dup, Err: underlyingError(err)}
+	}
+	return
+}
+
+// underlyingError strips the temporary file name from errors of replacing.
+func underlyingError(err error) error {
+	switch e := err.(type) {
+	case *os.PathError:
+		return e.Err
+	case *os.LinkError:
+		return e.Err
+	}
+	return err
+}
+
+func sameContent(a, b string) (same bool, err error) {
+	fa, err := os.Open(a)
+	if err != nil {
+		return
+	}
+	defer fa.Close()
+	fb, err := os.Open(b)
+	if err != nil {
+		return
+	}
+	defer fb.Close()
+
+	bufA, bufB := make([]byte, 64<<10), make([]byte, 64<<10)
+	for {
+		na, errA := io.ReadFull(fa, bufA)
+		nb, errB := io.ReadFull(fb, bufB)
+		if errA != nil && errA != io.EOF && errA != io.ErrUnexpectedEOF {
+			return false, errA
+		}
+		if errB != nil && errB != io.EOF && errB != io.ErrUnexpectedEOF {
+			return false, errB
+		}
+		if !bytes.Equal(bufA[:na], bufB[:nb]) {
+			return false, nil
+		}
+		if errA != nil || errB != nil {
+			return errA != nil && errB != nil, nil
+		}
+	}
+}
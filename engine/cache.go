@@ -0,0 +1,166 @@
+package engine
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/erinacio/sha256s/hashsum"
+)
+
+type cacheKey struct {
+	Algorithm string
+	Dev       uint64
+	Ino       uint64
+}
+
+type cacheEntry struct {
+	ID   FileID
+	Sum  []byte
+	Path string
+	Used bool
+}
+
+// Cache keeps digests of files by their identity, so that unchanged files
+// needn't be hashed again.  It's safe for concurrent use.
+//
+// The cache file has a line per file of the form
+//
+//	<algorithm> <dev> <ino> <size> <mtime> <ctime> <hex digest> <path>
+//
+// with the path escaped like in checksum files.
+type Cache struct {
+	Rehash bool // ignore cached digests, but still update them
+
+	mu      sync.Mutex
+	entries map[cacheKey]*cacheEntry
+}
+
+// LoadCache reads a cache file, a missing file gives an empty cache.
+func LoadCache(path string) (*Cache, error) {
+	c := &Cache{entries: make(map[cacheKey]*cacheEntry)}
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scn := bufio.NewScanner(file)
+	var lineNo int
+	for scn.Scan() {
+		lineNo++
+		key, entry, ok := parseCacheLine(scn.Text())
+		if !ok {
+			return nil, fmt.Errorf("%s: %d: improperly formatted cache line", path, lineNo)
+		}
+		c.entries[key] = entry
+	}
+	if err := scn.Err(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func parseCacheLine(line string) (key cacheKey, entry *cacheEntry, ok bool) {
+	fields := strings.SplitN(line, " ", 8)
+	if len(fields) != 8 {
+		return
+	}
+	entry = &cacheEntry{}
+	var errs [6]error
+	key.Algorithm = fields[0]
+	key.Dev, errs[0] = strconv.ParseUint(fields[1], 10, 64)
+	key.Ino, errs[1] = strconv.ParseUint(fields[2], 10, 64)
+	entry.ID.Size, errs[2] = strconv.ParseInt(fields[3], 10, 64)
+	entry.ID.Mtime, errs[3] = strconv.ParseInt(fields[4], 10, 64)
+	entry.ID.Ctime, errs[4] = strconv.ParseInt(fields[5], 10, 64)
+	entry.Sum, errs[5] = hex.DecodeString(fields[6])
+	for _, err := range errs {
+		if err != nil {
+			return
+		}
+	}
+	entry.ID.Dev, entry.ID.Ino = key.Dev, key.Ino
+	entry.Path = hashsum.UnescapeName(fields[7])
+	return key, entry, true
+}
+
+// Lookup returns the cached checksum of a file, unless its identity changed.
+func (c *Cache) Lookup(algo string, id FileID) (sum []byte, ok bool) {
+	if c.Rehash {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[cacheKey{Algorithm: algo, Dev: id.Dev, Ino: id.Ino}]
+	if !ok || entry.ID != id {
+		return nil, false
+	}
+	entry.Used = true
+	return entry.Sum, true
+}
+
+// Store caches the checksum of a file with its identity.
+func (c *Cache) Store(algo string, id FileID, path string, sum []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[cacheKey{Algorithm: algo, Dev: id.Dev, Ino: id.Ino}] = &cacheEntry{
+		ID:   id,
+		Sum:  sum,
+		Path: path,
+		Used: true,
+	}
+}
+
+// Save writes the cache file atomically.  Stale entries, which are neither
+// used in this run nor match their file any more, are dropped.
+func (c *Cache) Save(path string) (err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			_ = tmp.Close()
+			_ = os.Remove(tmp.Name())
+		}
+	}()
+
+	w := bufio.NewWriter(tmp)
+	for key, entry := range c.entries {
+		if !entry.Used && !entry.stillValid() {
+			delete(c.entries, key)
+			continue
+		}
+		name, _ := hashsum.EscapeName(entry.Path)
+		_, _ = fmt.Fprintf(w, "%s %d %d %d %d %d %s %s\n", key.Algorithm, key.Dev, key.Ino,
+			entry.ID.Size, entry.ID.Mtime, entry.ID.Ctime, hex.EncodeToString(entry.Sum), name)
+	}
+	if err = w.Flush(); err != nil {
+		return
+	}
+	if err = tmp.Close(); err != nil {
+		return
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (e *cacheEntry) stillValid() bool {
+	info, err := os.Stat(e.Path)
+	if err != nil {
+		return false
+	}
+	id, ok := FileIdentity(info)
+	return ok && id == e.ID
+}
@@ -0,0 +1,347 @@
+// Package engine hashes files in parallel with a bounded number of workers.
+package engine
+
+import (
+	"context"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/erinacio/sha256s/hashsum"
+)
+
+// Job is a file to hash.
+type Job struct {
+	Name      string
+	Open      func() (io.ReadCloser, error) // if set, opens the content instead of Name
+	Algorithm hashsum.Algorithm             // zero value for the engine's algorithm
+	Data      interface{}                   // passed to the result untouched
+	Err       error                         // if set, the job is passed to the result without hashing
+}
+
+// Result is the outcome of a job.  Seq is the position of the job in the
+// source, so that results can be put back in order.
+type Result struct {
+	Job
+	Seq  int
+	Sum  []byte
+	Size int64       // number of bytes hashed
+	Info os.FileInfo // taken before hashing, nil if not available
+
+	Worker   int           // index of the worker which hashed the job, from 0
+	Duration time.Duration // time taken to open and hash the file
+}
+
+// OpenFunc opens a file of a job for reading.
+type OpenFunc func(name string) (io.ReadCloser, error)
+
+// Engine hashes jobs with at most Jobs workers.  With at least 16 workers,
+// small SHA256 files are hashed through the AVX-512 multi-buffer
+// implementation, 16 at a time, on CPUs which support it and lack the faster
+// SHA extensions.  The digests are the same either way.
+type Engine struct {
+	Jobs      int               // number of workers, 1 if not positive
+	Algorithm hashsum.Algorithm // algorithm of jobs without one, SHA256 if zero
+	Open      OpenFunc          // opens files for reading, os.Open if nil
+	Cache     *Cache            // reuses digests of unchanged files if not nil
+
+	IO         IOStrategy // how files are read, IORead if empty
+	BufferSize int        // size of read buffers and mapped chunks, 32 KiB if not positive
+	Stats      *IOStats   // collects throughput of each strategy if not nil
+	Progress   *Progress  // counts files and bytes done if not nil
+
+	// Limiter limits the read rate of all workers, and the rate of
+	// FileLimiter that of each file, which follows changes of the rate while
+	// reading.  Files aren't mapped when limited.
+	Limiter     *RateLimiter
+	FileLimiter *RateLimiter
+
+	// HardLinks hashes files with several hard links once per run, and
+	// reuses the digest for the other links.
+	HardLinks bool
+	links     *linkTable
+}
+
+// Files smaller than this are hashed by the multi-buffer implementation, when
+// there are at least multiBufferLanes workers to fill its lanes.
+const (
+	multiBufferMaxSize = 256 << 10
+	multiBufferLanes   = 16
+)
+
+type multiBuffer struct {
+	hash hash.Hash
+	buf  []byte
+}
+
+// Run hashes jobs from src until it is closed or ctx is done, and sends the
+// results to the returned channel, which is closed after the last one.
+// Results arrive in completion order.  After ctx is done, ongoing reads are
+// interrupted, remaining jobs are dropped, and the channel is closed soon;
+// sources should stop sending on ctx.Done() to avoid blocking forever.
+func (e Engine) Run(ctx context.Context, src <-chan Job) <-chan Result {
+	jobs := e.Jobs
+	if jobs <= 0 {
+		jobs = 1
+	}
+	if e.Algorithm.New == nil {
+		e.Algorithm = hashsum.DefaultAlgorithm
+	}
+	if e.BufferSize <= 0 {
+		e.BufferSize = 32 << 10
+	}
+	if e.Open == nil {
+		e.Open = func(name string) (io.ReadCloser, error) { return os.Open(name) }
+	}
+	if e.HardLinks {
+		e.links = newLinkTable()
+	}
+
+	seqCh := make(chan Result)
+	resultCh := make(chan Result)
+	go func() {
+		defer close(seqCh)
+		var seq int
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case job, ok := <-src:
+				if !ok {
+					return
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case seqCh <- Result{Job: job, Seq: seq}:
+					seq++
+				}
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	wg.Add(jobs)
+	go func() {
+		wg.Wait()
+		close(resultCh)
+	}()
+	for i := 0; i < jobs; i++ {
+		go e.worker(ctx, i, &wg, seqCh, resultCh)
+	}
+	return resultCh
+}
+
+// worker holds the reusable state of a worker.
+type worker struct {
+	hashes map[string]hash.Hash
+	mb     *multiBuffer
+	buf    []byte
+}
+
+func (e Engine) worker(ctx context.Context, index int, wg *sync.WaitGroup, seqCh <-chan Result, resultCh chan<- Result) {
+	defer wg.Done()
+	w := &worker{
+		hashes: make(map[string]hash.Hash, 1),
+		buf:    make([]byte, e.BufferSize),
+	}
+	if e.Jobs >= multiBufferLanes && multiBufferSupported {
+		w.mb = &multiBuffer{hash: acquireMultiBufferHash(), buf: make([]byte, multiBufferMaxSize)}
+		defer releaseMultiBufferHash(w.mb.hash)
+	}
+	for result := range seqCh {
+		if result.Err == nil {
+			algo := result.Algorithm
+			if algo.New == nil {
+				algo = e.Algorithm
+			}
+			h, ok := w.hashes[algo.Name]
+			if !ok {
+				h = algo.New()
+				w.hashes[algo.Name] = h
+			}
+			start := time.Now()
+			result.Sum, result.Size, result.Info, result.Err = e.fileHash(ctx, w, algo.Name, h, result.Job)
+			result.Worker, result.Duration = index, time.Since(start)
+		} else {
+			e.Progress.finish(nil, 0)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case resultCh <- result:
+		}
+	}
+}
+
+func (e Engine) fileHash(ctx context.Context, w *worker, algo string, hash hash.Hash, job Job) (sum []byte, size int64, info os.FileInfo, err error) {
+	var pf *progressFile
+	defer func() { e.Progress.finish(pf, size) }()
+
+	var file io.ReadCloser
+	if job.Open != nil {
+		file, err = job.Open()
+	} else {
+		file, err = e.Open(job.Name)
+	}
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	f, isOSFile := file.(*os.File)
+	if isOSFile {
+		info, _ = f.Stat()
+	}
+	id, cacheable := e.cachedIdentity(info)
+	if cacheable {
+		if sum, ok := e.Cache.Lookup(algo, id); ok {
+			return sum, id.Size, info, nil
+		}
+	}
+	if link, owner := e.claimLink(algo, info); owner {
+		defer func() { link.finish(sum, size, err) }()
+	} else if link != nil {
+		select {
+		case <-ctx.Done():
+			return nil, 0, info, ctx.Err()
+		case <-link.done:
+		}
+		if link.err == nil {
+			return link.sum, link.size, info, nil
+		}
+	}
+
+	var src io.Reader = file
+	if e.Progress != nil {
+		var expected int64
+		if info != nil {
+			expected = info.Size()
+		}
+		pf = e.Progress.start(job.Name, expected)
+		src = progressReader{r: file, p: e.Progress, f: pf}
+	}
+	limited := e.Limiter != nil || e.FileLimiter != nil
+	if limited {
+		r := rateLimitedReader{ctx: ctx, r: src, limiters: [2]*RateLimiter{e.Limiter}}
+		if e.FileLimiter != nil {
+			r.limiters[1], r.fileRate = e.FileLimiter.newFileLimiter(), e.FileLimiter
+		}
+		src = r
+	}
+	start := time.Now()
+	regular := info != nil && info.Mode().IsRegular()
+	strategy := IORead
+	switch {
+	case w.mb != nil && algo == "SHA256" && regular && info.Size() < multiBufferMaxSize:
+		sum, size, err = w.mb.fileHash(ctx, hash, src)
+	case e.IO == IOMmap && !limited && isOSFile && regular && info.Size() > int64(len(w.buf)):
+		var mapped bool
+		sum, size, mapped, err = mmapHash(ctx, hash, f, info.Size(), len(w.buf))
+		if mapped {
+			strategy = IOMmap
+			break
+		}
+		if _, err = f.Seek(0, io.SeekStart); err != nil {
+			break
+		}
+		fallthrough
+	default:
+		hash.Reset()
+		if size, err = io.CopyBuffer(hash, contextReader{ctx: ctx, r: src}, w.buf); err == nil {
+			sum = hash.Sum(nil)
+		}
+	}
+	if err == nil && e.Stats != nil {
+		e.Stats.add(strategy, size, time.Since(start))
+	}
+	if err == nil && cacheable {
+		// the file might have been changed while hashing
+		newInfo, _ := f.Stat()
+		newID, ok := e.cachedIdentity(newInfo)
+		if path, err := filepath.Abs(job.Name); err == nil && ok && newID == id {
+			e.Cache.Store(algo, id, path, sum)
+		}
+	}
+	return
+}
+
+// cachedIdentity returns the identity of a regular file if it can be cached.
+func (e Engine) cachedIdentity(info os.FileInfo) (id FileID, ok bool) {
+	if e.Cache == nil || info == nil || !info.Mode().IsRegular() {
+		return id, false
+	}
+	return FileIdentity(info)
+}
+
+// claimLink returns the link entry of a file with several hard links, if
+// hard links are hashed once.  If the file has been changed since the entry
+// was claimed, entry is nil.
+func (e Engine) claimLink(algo string, info os.FileInfo) (entry *linkEntry, owner bool) {
+	if e.links == nil || info == nil || !info.Mode().IsRegular() || LinkCount(info) < 2 {
+		return nil, false
+	}
+	id, ok := FileIdentity(info)
+	if !ok {
+		return nil, false
+	}
+	entry, owner = e.links.claim(algo, id)
+	if entry.id != id {
+		return nil, false
+	}
+	return
+}
+
+// fileHash reads a whole small file into the buffer and hashes it in a single
+// write, because the multi-buffer digest keeps referencing written data until
+// the sum is done.  Files grown larger than the buffer are finished with the
+// fallback hash.
+func (mb *multiBuffer) fileHash(ctx context.Context, fallback hash.Hash, file io.Reader) (sum []byte, size int64, err error) {
+	n, err := io.ReadFull(contextReader{ctx: ctx, r: file}, mb.buf)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		mb.hash.Reset()
+		_, _ = mb.hash.Write(mb.buf[:n])
+		return mb.hash.Sum(nil), int64(n), nil
+	} else if err != nil {
+		return
+	}
+	fallback.Reset()
+	_, _ = fallback.Write(mb.buf[:n])
+	if size, err = io.Copy(fallback, contextReader{ctx: ctx, r: file}); err == nil {
+		sum = fallback.Sum(nil)
+	}
+	size += int64(n)
+	return
+}
+
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r contextReader) Read(p []byte) (n int, err error) {
+	if err = r.ctx.Err(); err != nil {
+		return
+	}
+	return r.r.Read(p)
+}
+
+// Names returns a source of jobs hashing the named files, which stops on
+// ctx.Done().
+func Names(ctx context.Context, names ...string) <-chan Job {
+	src := make(chan Job)
+	go func() {
+		defer close(src)
+		for _, name := range names {
+			select {
+			case <-ctx.Done():
+				return
+			case src <- Job{Name: name}:
+			}
+		}
+	}()
+	return src
+}
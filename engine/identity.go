@@ -0,0 +1,26 @@
+package engine
+
+import (
+	"os"
+)
+
+// FileID identifies the content of a file, which is assumed unchanged as long
+// as the identity is the same.
+type FileID struct {
+	Dev   uint64
+	Ino   uint64
+	Size  int64
+	Mtime int64 // nanoseconds since the epoch
+	Ctime int64 // nanoseconds since the epoch
+}
+
+// FileIdentity returns the identity of a file, ok is false on systems without
+// inode numbers or change times.
+func FileIdentity(info os.FileInfo) (id FileID, ok bool) {
+	return fileIdentity(info)
+}
+
+// LinkCount returns the number of hard links to a file, 0 if unknown.
+func LinkCount(info os.FileInfo) uint64 {
+	return linkCount(info)
+}
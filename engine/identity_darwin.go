@@ -0,0 +1,27 @@
+package engine
+
+import (
+	"os"
+	"syscall"
+)
+
+func fileIdentity(info os.FileInfo) (id FileID, ok bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return
+	}
+	return FileID{
+		Dev:   uint64(st.Dev),
+		Ino:   st.Ino,
+		Size:  st.Size,
+		Mtime: st.Mtimespec.Nano(),
+		Ctime: st.Ctimespec.Nano(),
+	}, true
+}
+
+func linkCount(info os.FileInfo) uint64 {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return uint64(st.Nlink)
+	}
+	return 0
+}
@@ -0,0 +1,16 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package engine
+
+import (
+	"os"
+)
+
+func fileIdentity(info os.FileInfo) (id FileID, ok bool) {
+	return
+}
+
+func linkCount(info os.FileInfo) uint64 {
+	return 0
+}
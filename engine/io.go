@@ -0,0 +1,61 @@
+package engine
+
+import (
+	"sync"
+	"time"
+)
+
+// IOStrategy is how files are read for hashing.
+type IOStrategy string
+
+const (
+	IORead IOStrategy = "read" // read into a buffer
+	IOMmap IOStrategy = "mmap" // hash files larger than the buffer from a memory map
+)
+
+// IOStats collects the throughput of each strategy, it's safe for concurrent
+// use.  Files whose digests come from the cache aren't counted.
+type IOStats struct {
+	mu         sync.Mutex
+	strategies map[IOStrategy]*IOStrategyStats
+}
+
+type IOStrategyStats struct {
+	Files    int64
+	Bytes    int64
+	Duration time.Duration // summed over all workers
+}
+
+// Throughput returns bytes per second of a single worker.
+func (s IOStrategyStats) Throughput() float64 {
+	if s.Duration <= 0 {
+		return 0
+	}
+	return float64(s.Bytes) / s.Duration.Seconds()
+}
+
+func (s *IOStats) add(strategy IOStrategy, size int64, d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.strategies == nil {
+		s.strategies = make(map[IOStrategy]*IOStrategyStats)
+	}
+	st, ok := s.strategies[strategy]
+	if !ok {
+		st = &IOStrategyStats{}
+		s.strategies[strategy] = st
+	}
+	st.Files++
+	st.Bytes += size
+	st.Duration += d
+}
+
+// Get returns the stats of a strategy.
+func (s *IOStats) Get(strategy IOStrategy) IOStrategyStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if st, ok := s.strategies[strategy]; ok {
+		return *st
+	}
+	return IOStrategyStats{}
+}
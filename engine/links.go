@@ -0,0 +1,50 @@
+package engine
+
+import (
+	"sync"
+)
+
+type linkKey struct {
+	Algorithm string
+	Dev       uint64
+	Ino       uint64
+}
+
+// linkEntry is the digest of a file with several hard links, which is
+// available once done is closed.
+type linkEntry struct {
+	done chan struct{}
+	id   FileID
+	sum  []byte
+	size int64
+	err  error
+}
+
+// linkTable makes files with several hard links hashed once per run.
+type linkTable struct {
+	mu      sync.Mutex
+	entries map[linkKey]*linkEntry
+}
+
+func newLinkTable() *linkTable {
+	return &linkTable{entries: make(map[linkKey]*linkEntry)}
+}
+
+// claim returns the entry of a file, owner is true if the caller is the first
+// to claim it and must finish it.
+func (t *linkTable) claim(algo string, id FileID) (entry *linkEntry, owner bool) {
+	key := linkKey{Algorithm: algo, Dev: id.Dev, Ino: id.Ino}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if entry, ok := t.entries[key]; ok {
+		return entry, false
+	}
+	entry = &linkEntry{done: make(chan struct{}), id: id}
+	t.entries[key] = entry
+	return entry, true
+}
+
+func (e *linkEntry) finish(sum []byte, size int64, err error) {
+	e.sum, e.size, e.err = sum, size, err
+	close(e.done)
+}
@@ -0,0 +1,14 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package engine
+
+import (
+	"context"
+	"hash"
+	"os"
+)
+
+func mmapHash(ctx context.Context, hash hash.Hash, file *os.File, size int64, chunk int) (sum []byte, n int64, mapped bool, err error) {
+	return
+}
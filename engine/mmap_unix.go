@@ -0,0 +1,66 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package engine
+
+import (
+	"context"
+	"errors"
+	"hash"
+	"os"
+	"runtime/debug"
+
+	"golang.org/x/sys/unix"
+)
+
+var errMappedFileTruncated = errors.New("mapped file truncated")
+
+// mmapHash hashes a file from a memory map, in chunks so that ctx is checked
+// regularly.  If the file can't be mapped, or is truncated while hashing,
+// mapped is false and the caller should read the file instead.
+func mmapHash(ctx context.Context, hash hash.Hash, file *os.File, size int64, chunk int) (sum []byte, n int64, mapped bool, err error) {
+	if int64(int(size)) != size {
+		return
+	}
+	data, err := unix.Mmap(int(file.Fd()), 0, int(size), unix.PROT_READ, unix.MAP_SHARED)
+	if err != nil {
+		return nil, 0, false, nil
+	}
+	defer unix.Munmap(data)
+	_ = unix.Madvise(data, unix.MADV_SEQUENTIAL)
+
+	err = hashMapped(ctx, hash, data, chunk)
+	if err == errMappedFileTruncated {
+		return nil, 0, false, nil
+	} else if err != nil {
+		return nil, 0, true, err
+	}
+	return hash.Sum(nil), size, true, nil
+}
+
+// hashMapped turns the fault of accessing pages beyond the end of a truncated
+// file into errMappedFileTruncated.
+func hashMapped(ctx context.Context, hash hash.Hash, data []byte, chunk int) (err error) {
+	defer debug.SetPanicOnFault(debug.SetPanicOnFault(true))
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(interface{ Addr() uintptr }); ok {
+				err = errMappedFileTruncated
+				return
+			}
+			panic(r)
+		}
+	}()
+	hash.Reset()
+	for off := 0; off < len(data); off += chunk {
+		if err = ctx.Err(); err != nil {
+			return
+		}
+		end := off + chunk
+		if end > len(data) {
+			end = len(data)
+		}
+		_, _ = hash.Write(data[off:end])
+	}
+	return
+}
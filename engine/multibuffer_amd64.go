@@ -0,0 +1,51 @@
+//go:build !noasm && !appengine && gc
+// +build !noasm,!appengine,gc
+
+package engine
+
+import (
+	"hash"
+	"sync"
+
+	"github.com/klauspost/cpuid/v2"
+	"github.com/minio/sha256-simd"
+)
+
+// The same check as sha256-simd uses to enable AVX-512.  Multi-buffer hashing
+// isn't used if the SHA extensions are present, which are faster on their own.
+var (
+	avx512Supported      = cpuid.CPU.Supports(cpuid.AVX512F, cpuid.AVX512DQ, cpuid.AVX512BW, cpuid.AVX512VL)
+	multiBufferSupported = avx512Supported && !cpuid.CPU.Supports(cpuid.SHA)
+)
+
+// Multi-buffer digests are shared by all engines, because the servers behind
+// them never stop.  Each server has 16 lanes, a lane is picked by the lowest
+// 4 bits of an ever increasing digest id, so 16 digests created in a row use
+// every lane of their server once.
+var multiBufferHashes struct {
+	sync.Mutex
+	free    []hash.Hash
+	server  *sha256.Avx512Server
+	created int
+}
+
+func acquireMultiBufferHash() hash.Hash {
+	multiBufferHashes.Lock()
+	defer multiBufferHashes.Unlock()
+	if n := len(multiBufferHashes.free); n > 0 {
+		h := multiBufferHashes.free[n-1]
+		multiBufferHashes.free = multiBufferHashes.free[:n-1]
+		return h
+	}
+	if multiBufferHashes.created%16 == 0 {
+		multiBufferHashes.server = sha256.NewAvx512Server()
+	}
+	multiBufferHashes.created++
+	return sha256.NewAvx512(multiBufferHashes.server)
+}
+
+func releaseMultiBufferHash(h hash.Hash) {
+	multiBufferHashes.Lock()
+	defer multiBufferHashes.Unlock()
+	multiBufferHashes.free = append(multiBufferHashes.free, h)
+}
@@ -0,0 +1,14 @@
+//go:build !amd64 || noasm || appengine || !gc
+// +build !amd64 noasm appengine !gc
+
+package engine
+
+import (
+	"hash"
+)
+
+var avx512Supported, multiBufferSupported = false, false
+
+func acquireMultiBufferHash() hash.Hash { return nil }
+
+func releaseMultiBufferHash(h hash.Hash) {}
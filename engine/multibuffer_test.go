@@ -0,0 +1,94 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeSmallFiles writes n files of random content and sizes up to maxSize
+// bytes, and returns their names.
+func writeSmallFiles(tb testing.TB, n, maxSize int) []string {
+	tb.Helper()
+	dir := tb.TempDir()
+	rnd := rand.New(rand.NewSource(1))
+	names := make([]string, n)
+	for i := range names {
+		content := make([]byte, rnd.Intn(maxSize+1))
+		rnd.Read(content)
+		names[i] = filepath.Join(dir, fmt.Sprint(i))
+		if err := os.WriteFile(names[i], content, 0644); err != nil {
+			tb.Fatal(err)
+		}
+	}
+	return names
+}
+
+// forceMultiBuffer uses the multi-buffer implementation whenever AVX-512 is
+// available, even with the SHA extensions.
+func forceMultiBuffer(tb testing.TB) {
+	tb.Helper()
+	if !avx512Supported {
+		tb.Skip("AVX-512 unsupported")
+	}
+	saved := multiBufferSupported
+	multiBufferSupported = true
+	tb.Cleanup(func() { multiBufferSupported = saved })
+}
+
+func hashAll(tb testing.TB, e Engine, names []string) map[string][]byte {
+	tb.Helper()
+	sums := make(map[string][]byte, len(names))
+	for result := range e.Run(context.Background(), Names(context.Background(), names...)) {
+		if result.Err != nil {
+			tb.Fatal(result.Err)
+		}
+		sums[result.Name] = result.Sum
+	}
+	return sums
+}
+
+func TestMultiBufferDigests(t *testing.T) {
+	forceMultiBuffer(t)
+	// some files are too large for the multi-buffer implementation
+	names := writeSmallFiles(t, 200, multiBufferMaxSize+(64<<10))
+	sums := hashAll(t, Engine{Jobs: multiBufferLanes}, names)
+	for _, name := range names {
+		content, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := sha256.Sum256(content); !bytes.Equal(sums[name], want[:]) {
+			t.Errorf("%s: digest of %d bytes = %x, want %x", name, len(content), sums[name], want)
+		}
+	}
+}
+
+func TestMultiBufferFallback(t *testing.T) {
+	mb := &multiBuffer{hash: sha256.New(), buf: make([]byte, 16)}
+	content := bytes.Repeat([]byte("0123456789"), 10)
+	sum, size, err := mb.fileHash(context.Background(), sha256.New(), bytes.NewReader(content))
+	if want := sha256.Sum256(content); err != nil || size != int64(len(content)) || !bytes.Equal(sum, want[:]) {
+		t.Errorf("fileHash() = %x, %d, %v, want %x, %d, nil", sum, size, err, want, len(content))
+	}
+}
+
+func BenchmarkSmallFiles(b *testing.B) {
+	names := writeSmallFiles(b, 2000, 16<<10)
+	b.Run("sha256", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			hashAll(b, Engine{Jobs: multiBufferLanes}, names)
+		}
+	})
+	b.Run("multi-buffer", func(b *testing.B) {
+		forceMultiBuffer(b)
+		for i := 0; i < b.N; i++ {
+			hashAll(b, Engine{Jobs: multiBufferLanes}, names)
+		}
+	})
+}
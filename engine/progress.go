@@ -0,0 +1,126 @@
+package engine
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// Progress counts files and bytes done by an engine while it runs.  Totals
+// are optional, and are added by whoever scans the sources ahead.  It's safe
+// for concurrent use, and a nil Progress counts nothing.
+type Progress struct {
+	files      int64
+	bytes      int64
+	totalFiles int64
+	totalBytes int64
+	totalKnown int32
+
+	mu       sync.Mutex
+	inFlight map[*progressFile]struct{}
+}
+
+// ProgressSnapshot is the state of a Progress at some time.
+type ProgressSnapshot struct {
+	Files      int64 // jobs done, including failed ones
+	Bytes      int64 // bytes read, or taken from the cache
+	TotalFiles int64
+	TotalBytes int64
+	TotalKnown bool // totals are complete
+
+	Current     string // largest file being hashed, empty if none
+	CurrentSize int64
+	CurrentDone int64
+}
+
+type progressFile struct {
+	name string
+	size int64
+	done int64
+}
+
+// AddTotal adds files and bytes to the totals.
+func (p *Progress) AddTotal(files, bytes int64) {
+	if p == nil {
+		return
+	}
+	atomic.AddInt64(&p.totalFiles, files)
+	atomic.AddInt64(&p.totalBytes, bytes)
+}
+
+// SetTotalKnown marks the totals complete.
+func (p *Progress) SetTotalKnown() {
+	if p == nil {
+		return
+	}
+	atomic.StoreInt32(&p.totalKnown, 1)
+}
+
+// Snapshot returns the counters and totals, and the largest file being hashed
+// as the current one.
+func (p *Progress) Snapshot() (s ProgressSnapshot) {
+	if p == nil {
+		return
+	}
+	s.Files = atomic.LoadInt64(&p.files)
+	s.Bytes = atomic.LoadInt64(&p.bytes)
+	s.TotalFiles = atomic.LoadInt64(&p.totalFiles)
+	s.TotalBytes = atomic.LoadInt64(&p.totalBytes)
+	s.TotalKnown = atomic.LoadInt32(&p.totalKnown) != 0
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for f := range p.inFlight {
+		if s.Current == "" || f.size > s.CurrentSize {
+			s.Current, s.CurrentSize = f.name, f.size
+			s.CurrentDone = atomic.LoadInt64(&f.done)
+		}
+	}
+	return
+}
+
+// start registers a file being hashed.
+func (p *Progress) start(name string, size int64) *progressFile {
+	if p == nil {
+		return nil
+	}
+	f := &progressFile{name: name, size: size}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.inFlight == nil {
+		p.inFlight = make(map[*progressFile]struct{})
+	}
+	p.inFlight[f] = struct{}{}
+	return f
+}
+
+// finish counts a job done, size bytes that weren't read through a
+// progressReader are counted as well.
+func (p *Progress) finish(f *progressFile, size int64) {
+	if p == nil {
+		return
+	}
+	if f != nil {
+		p.mu.Lock()
+		delete(p.inFlight, f)
+		p.mu.Unlock()
+		size -= atomic.LoadInt64(&f.done)
+	}
+	if size > 0 {
+		atomic.AddInt64(&p.bytes, size)
+	}
+	atomic.AddInt64(&p.files, 1)
+}
+
+// progressReader counts bytes read from a file.
+type progressReader struct {
+	r io.Reader
+	p *Progress
+	f *progressFile
+}
+
+func (r progressReader) Read(b []byte) (n int, err error) {
+	n, err = r.r.Read(b)
+	atomic.AddInt64(&r.f.done, int64(n))
+	atomic.AddInt64(&r.p.bytes, int64(n))
+	return
+}
@@ -0,0 +1,133 @@
+package engine
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// RateLimiter limits the rate of reading with a token bucket holding up to
+// a tenth of a second of bytes, so that reading is smooth rather than in
+// bursts.  It's safe for concurrent use, and its rate can be changed while
+// reading.
+type RateLimiter struct {
+	mu     sync.Mutex
+	rate   float64 // bytes per second, unlimited if not positive
+	tokens float64 // negative if reserved ahead
+	last   time.Time
+	clock  clock
+}
+
+// clock is the time source of a limiter, replaced by tests.
+type clock interface {
+	Now() time.Time
+	After(d time.Duration) (<-chan time.Time, func())
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+func (realClock) After(d time.Duration) (<-chan time.Time, func()) {
+	timer := time.NewTimer(d)
+	return timer.C, func() { timer.Stop() }
+}
+
+// NewRateLimiter returns a limiter of rate bytes per second.
+func NewRateLimiter(rate int64) *RateLimiter {
+	return newRateLimiter(rate, realClock{})
+}
+
+func newRateLimiter(rate int64, c clock) *RateLimiter {
+	return &RateLimiter{rate: float64(rate), last: c.Now(), clock: c}
+}
+
+// newFileLimiter returns a limiter of a file at the current rate.
+func (l *RateLimiter) newFileLimiter() *RateLimiter {
+	return newRateLimiter(l.Rate(), l.clock)
+}
+
+// Rate returns the rate in bytes per second.
+func (l *RateLimiter) Rate() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return int64(l.rate)
+}
+
+// SetRate changes the rate, waiting readers keep their reservations.
+func (l *RateLimiter) SetRate(rate int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.refill(l.clock.Now())
+	l.rate = float64(rate)
+}
+
+func (l *RateLimiter) refill(now time.Time) {
+	if l.rate > 0 {
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		if burst := l.rate / 10; l.tokens > burst {
+			l.tokens = burst
+		}
+	}
+	l.last = now
+}
+
+// wait takes n bytes from the bucket, waiting until they would have been
+// available if the bucket is in debt.
+func (l *RateLimiter) wait(ctx context.Context, n int) error {
+	l.mu.Lock()
+	l.refill(l.clock.Now())
+	if l.rate <= 0 {
+		l.mu.Unlock()
+		return nil
+	}
+	l.tokens -= float64(n)
+	delay := time.Duration(-l.tokens / l.rate * float64(time.Second))
+	l.mu.Unlock()
+	if delay <= 0 {
+		return nil
+	}
+	done, stop := l.clock.After(delay)
+	defer stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-done:
+		return nil
+	}
+}
+
+// Reads are split into chunks of at most this size, so that a single read
+// doesn't take a long reservation.
+const rateLimitChunk = 64 << 10
+
+// rateLimitedReader reads through limiters, which may be nil.  The second
+// one follows the rate of fileRate if not nil.
+type rateLimitedReader struct {
+	ctx      context.Context
+	r        io.Reader
+	limiters [2]*RateLimiter
+	fileRate *RateLimiter
+}
+
+func (r rateLimitedReader) Read(p []byte) (n int, err error) {
+	if len(p) > rateLimitChunk {
+		p = p[:rateLimitChunk]
+	}
+	if r.fileRate != nil {
+		if rate := r.fileRate.Rate(); rate != r.limiters[1].Rate() {
+			r.limiters[1].SetRate(rate)
+		}
+	}
+	n, err = r.r.Read(p)
+	for _, l := range r.limiters {
+		if l == nil {
+			continue
+		}
+		if waitErr := l.wait(r.ctx, n); waitErr != nil && err == nil {
+			err = waitErr
+		}
+	}
+	return
+}
@@ -0,0 +1,159 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a clock whose waits pass at once, moving its time forward.
+// If block is set, waits never pass instead.
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	waits  []time.Duration
+	block  bool
+	closed chan time.Time
+}
+
+func newFakeClock() *fakeClock {
+	c := &fakeClock{now: time.Unix(0, 0), closed: make(chan time.Time)}
+	close(c.closed)
+	return c
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) (<-chan time.Time, func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.waits = append(c.waits, d)
+	if c.block {
+		return nil, func() {}
+	}
+	c.now = c.now.Add(d)
+	return c.closed, func() {}
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// waited returns the total time waited.
+func (c *fakeClock) waited() (total time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, d := range c.waits {
+		total += d
+	}
+	return
+}
+
+func within(d, want time.Duration) bool {
+	return d > want-time.Microsecond && d < want+time.Microsecond
+}
+
+func TestRateLimiterUnlimited(t *testing.T) {
+	c := newFakeClock()
+	l := newRateLimiter(0, c)
+	for i := 0; i < 100; i++ {
+		if err := l.wait(context.Background(), 1<<20); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(c.waits) != 0 {
+		t.Errorf("unlimited reads waited %v", c.waits)
+	}
+}
+
+func TestRateLimiterRate(t *testing.T) {
+	const rate = 1 << 20
+	c := newFakeClock()
+	l := newRateLimiter(rate, c)
+	if got := l.Rate(); got != rate {
+		t.Errorf("Rate() = %d, want %d", got, rate)
+	}
+	// the bucket starts empty, so reading a fifth of a second of bytes takes
+	// that long
+	r := rateLimitedReader{ctx: context.Background(), r: bytes.NewReader(make([]byte, rate/5)), limiters: [2]*RateLimiter{l}}
+	if n, err := io.Copy(ioutil.Discard, r); err != nil || n != rate/5 {
+		t.Fatalf("Copy() = %d, %v", n, err)
+	}
+	if d := c.waited(); !within(d, 200*time.Millisecond) {
+		t.Errorf("reading %d bytes at %d bytes per second took %v", rate/5, rate, d)
+	}
+
+	l.SetRate(rate * 2)
+	if got := l.Rate(); got != rate*2 {
+		t.Errorf("Rate() = %d after SetRate, want %d", got, rate*2)
+	}
+}
+
+func TestRateLimiterBurst(t *testing.T) {
+	const rate = 1000000
+	c := newFakeClock()
+	l := newRateLimiter(rate, c)
+	c.Advance(300 * time.Millisecond)
+	// at most a tenth of a second of bytes is saved up while idle
+	if err := l.wait(context.Background(), rate/10); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.waits) != 0 {
+		t.Errorf("reading the saved up bytes waited %v", c.waits)
+	}
+	if err := l.wait(context.Background(), rate/10); err != nil {
+		t.Fatal(err)
+	}
+	if d := c.waited(); !within(d, 100*time.Millisecond) {
+		t.Errorf("reading beyond the saved up bytes waited %v, want 100ms", d)
+	}
+}
+
+func TestRateLimiterCanceled(t *testing.T) {
+	c := newFakeClock()
+	c.block = true
+	l := newRateLimiter(1, c)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := l.wait(ctx, 1<<10); err != context.Canceled {
+		t.Errorf("wait() = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestFileLimiterFollowsRate(t *testing.T) {
+	const rate = 1 << 20
+	c := newFakeClock()
+	files := newRateLimiter(rate, c)
+	r := rateLimitedReader{ctx: context.Background(), r: bytes.NewReader(make([]byte, 2*rateLimitChunk))}
+	r.limiters[1], r.fileRate = files.newFileLimiter(), files
+	buf := make([]byte, rateLimitChunk)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		t.Fatal(err)
+	}
+	files.SetRate(2 * rate)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		t.Fatal(err)
+	}
+	want := []time.Duration{time.Second * rateLimitChunk / rate, time.Second * rateLimitChunk / (2 * rate)}
+	if len(c.waits) != 2 || !within(c.waits[0], want[0]) || !within(c.waits[1], want[1]) {
+		t.Errorf("waits = %v, want %v", c.waits, want)
+	}
+}
+
+func TestRateLimitedReaderChunks(t *testing.T) {
+	r := rateLimitedReader{ctx: context.Background(), r: bytes.NewReader(make([]byte, 3*rateLimitChunk))}
+	n, err := r.Read(make([]byte, 2*rateLimitChunk))
+	if err != nil || n != rateLimitChunk {
+		t.Errorf("Read() = %d, %v, want %d, nil", n, err, rateLimitChunk)
+	}
+}
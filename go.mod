@@ -5,7 +5,9 @@ go 1.17
 require (
 	github.com/minio/sha256-simd v1.0.0
 	github.com/spf13/pflag v1.0.5
+	golang.org/x/crypto v0.0.0-20210921155107-089bfa567519
+	golang.org/x/sys v0.0.0-20210615035016-665e8c7367d1
 	golang.org/x/text v0.3.7
 )
 
-require github.com/klauspost/cpuid/v2 v2.0.4 // indirect
+require github.com/klauspost/cpuid/v2 v2.0.4
@@ -0,0 +1,71 @@
+package hashsum
+
+import (
+	"crypto/sha1"
+	stdsha256 "crypto/sha256"
+	"crypto/sha512"
+	"hash"
+	"strings"
+
+	"github.com/minio/sha256-simd"
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/blake2s"
+)
+
+// Algorithm describes a hash algorithm usable in checksum files.
+type Algorithm struct {
+	Name    string   // name used in bsd tag format
+	Size    int      // hash result byte width
+	Aliases []string // alternative names accepted by LookupAlgorithm
+	New     func() hash.Hash
+}
+
+// Algorithms lists all supported algorithms.
+var Algorithms = []Algorithm{
+	{Name: "SHA1", Size: sha1.Size, Aliases: []string{"SHA-1"}, New: sha1.New},
+	{Name: "SHA224", Size: stdsha256.Size224, Aliases: []string{"SHA-224"}, New: stdsha256.New224},
+	DefaultAlgorithm,
+	{Name: "SHA384", Size: sha512.Size384, Aliases: []string{"SHA-384"}, New: sha512.New384},
+	{Name: "SHA512", Size: sha512.Size, Aliases: []string{"SHA-512"}, New: sha512.New},
+	{Name: "SHA512t256", Size: sha512.Size256, Aliases: []string{"SHA512/256", "SHA-512/256", "SHA512-256"}, New: sha512.New512_256},
+	{Name: "BLAKE2b", Size: blake2b.Size, Aliases: []string{"BLAKE2", "BLAKE2b-512"}, New: mustNewHash(blake2b.New512)},
+	{Name: "BLAKE2s", Size: blake2s.Size, Aliases: []string{"BLAKE2s-256"}, New: mustNewHash(blake2s.New256)},
+}
+
+// DefaultAlgorithm is SHA256.
+var DefaultAlgorithm = Algorithm{Name: "SHA256", Size: sha256.Size, Aliases: []string{"SHA-256"}, New: sha256.New}
+
+// LookupAlgorithm finds an algorithm by its name or one of its aliases,
+// ignoring case.
+func LookupAlgorithm(name string) (algo Algorithm, ok bool) {
+	for _, algo = range Algorithms {
+		if strings.EqualFold(algo.Name, name) {
+			return algo, true
+		}
+		for _, alias := range algo.Aliases {
+			if strings.EqualFold(alias, name) {
+				return algo, true
+			}
+		}
+	}
+	return Algorithm{}, false
+}
+
+// AlgorithmNames returns the names of all supported algorithms.
+func AlgorithmNames() []string {
+	names := make([]string, len(Algorithms))
+	for i, algo := range Algorithms {
+		names[i] = algo.Name
+	}
+	return names
+}
+
+func mustNewHash(newFn func(key []byte) (hash.Hash, error)) func() hash.Hash {
+	return func() hash.Hash {
+		h, err := newFn(nil)
+		if err != nil {
+			panic(err)
+		}
+		return h
+	}
+}
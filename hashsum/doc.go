@@ -0,0 +1,18 @@
+// Package hashsum reads and writes checksum files in the formats of GNU
+// coreutils sha256sum and its relatives.
+//
+// Two line formats are supported, the GNU format
+//
+//	<hex digest> <' ' or '*'><file name>
+//
+// and the BSD tag format
+//
+//	<algorithm> (<file name>) = <hex digest>
+//
+// Lines are separated by '\n', or by '\0' in zero mode.
+//
+// Outside of zero mode, a file name containing '\\' or '\n' is escaped by
+// replacing them with `\\` and `\n` respectively, and the whole line is then
+// prefixed with a single '\\'.  File names of lines without that prefix are
+// taken literally.  In zero mode no escaping is done at all.
+package hashsum
@@ -0,0 +1,47 @@
+package hashsum
+
+import (
+	"strings"
+)
+
+// UnescapeName reverses EscapeName.  Unknown escape sequences are kept as the
+// escaped character, and a trailing lone '\\' is kept as-is.
+func UnescapeName(name string) string {
+	var sb strings.Builder
+	sb.Grow(len(name))
+	var escaping bool
+	for _, ch := range name {
+		if escaping {
+			escaping = false
+			switch ch {
+			case '\\':
+				sb.WriteByte('\\')
+			case 'n':
+				sb.WriteByte('\n')
+			default:
+				sb.WriteRune(ch)
+			}
+		} else if ch == '\\' {
+			escaping = true
+		} else {
+			sb.WriteRune(ch)
+		}
+	}
+	if escaping {
+		sb.WriteByte('\\')
+	}
+	return sb.String()
+}
+
+var fileNameEscapeReplacer = strings.NewReplacer("\\", `\\`, "\n", `\n`)
+
+// EscapeName escapes '\\' and '\n' in name, changed reports whether the line
+// holding the name needs the '\\' prefix.
+func EscapeName(name string) (result string, changed bool) {
+	if strings.IndexAny(name, "\\\n") < 0 {
+		return name, false
+	}
+	result = fileNameEscapeReplacer.Replace(name)
+	changed = true
+	return
+}
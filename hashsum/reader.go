@@ -0,0 +1,211 @@
+package hashsum
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const malformed = "improperly formatted checksum line"
+
+// BadLineError reports a rejected line, reading can continue after it.
+type BadLineError struct {
+	Path   string
+	Line   int
+	Reason string // why the line is rejected, empty for a malformed line
+}
+
+func (e BadLineError) Error() string {
+	if e.Reason == "" {
+		return fmt.Sprintf("%s: %d: %s", e.Path, e.Line, malformed)
+	}
+	return fmt.Sprintf("%s: %d: %s", e.Path, e.Line, e.Reason)
+}
+
+// Entry is a parsed checksum line.
+type Entry struct {
+	Line      int       // 1-based line number
+	Algorithm Algorithm // algorithm given by tag or inferred from digest length
+	Sum       []byte
+	Name      string // unescaped file name
+	Tag       bool   // line is in bsd tag format
+	Binary    bool   // '*' flag of gnu format
+}
+
+// Reader reads checksum lines of both gnu and bsd tag format, which is
+// detected line by line. The algorithm of a bsd line is given by its tag, and
+// that of a gnu line is inferred from the digest length.
+//
+// The exported fields must be set before the first call to Next.
+type Reader struct {
+	Path    string    // path reported in errors
+	Default Algorithm // preferred for gnu lines of matching digest length
+	Zero    bool      // '\0' for line separation or not
+	CrLf    bool      // lines can ending with CRLF
+
+	rd     io.Reader
+	scn    *bufio.Scanner
+	lineNo int
+}
+
+// NewReader returns a Reader of rd, which is converted to UTF-8 by
+// TryToConvertToUTF8.
+func NewReader(rd io.Reader, path string) *Reader {
+	return &Reader{
+		Path:    path,
+		Default: DefaultAlgorithm,
+		rd:      rd,
+	}
+}
+
+// Next returns the next entry.  The error is a BadLineError for a rejected
+// line, after which reading can continue, and io.EOF at the end of input.
+// Any other error is fatal.
+func (r *Reader) Next() (entry Entry, err error) {
+	if r.scn == nil {
+		r.scn = bufio.NewScanner(TryToConvertToUTF8(r.rd))
+		if r.Zero {
+			r.scn.Split(byteTerminatedScanner('\x00'))
+		} else if !r.CrLf {
+			r.scn.Split(byteTerminatedScanner('\n'))
+		}
+	}
+	if !r.scn.Scan() {
+		if err = r.scn.Err(); err == nil {
+			err = io.EOF
+		}
+		return
+	}
+	r.lineNo++
+	entry, reason := r.parseLine(r.scn.Text())
+	entry.Line = r.lineNo
+	if reason != "" {
+		if reason == malformed {
+			reason = ""
+		}
+		return Entry{Line: r.lineNo}, BadLineError{Path: r.Path, Line: r.lineNo, Reason: reason}
+	}
+	return entry, nil
+}
+
+// ForEach calls fn for every entry and rejected line until the end of input,
+// and returns the first fatal error.
+func (r *Reader) ForEach(fn func(entry Entry, err error)) error {
+	for {
+		entry, err := r.Next()
+		if err == io.EOF {
+			return nil
+		} else if _, ok := err.(BadLineError); err != nil && !ok {
+			return err
+		}
+		fn(entry, err)
+	}
+}
+
+func byteTerminatedScanner(b byte) func(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	return func(data []byte, atEOF bool) (advance int, token []byte, err error) {
+		if atEOF && len(data) == 0 {
+			return 0, nil, nil
+		}
+		if i := bytes.IndexByte(data, b); i >= 0 {
+			return i + 1, data[0:i], nil
+		}
+		if atEOF {
+			return len(data), data, nil
+		}
+		return 0, nil, nil
+	}
+}
+
+// parseLine parses a line of either format, reason is non-empty if the line
+// is rejected.
+func (r *Reader) parseLine(line string) (entry Entry, reason string) {
+	escaped := !r.Zero && strings.HasPrefix(line, `\`)
+	if escaped {
+		line = line[1:]
+	}
+	var hexSum string
+	var ok bool
+	if i := strings.IndexByte(line, ' '); i > 0 && isHexString(line[:i]) {
+		hexSum, entry.Name, entry.Binary, ok = parseGnuSum(line)
+		if !ok || len(hexSum)%2 != 0 {
+			return entry, malformed
+		}
+		var candidates []string
+		entry.Algorithm, candidates = r.algorithmForWidth(len(hexSum) / 2)
+		if len(candidates) > 1 {
+			return entry, fmt.Sprintf("checksum length is ambiguous, matching %s", strings.Join(candidates, ", "))
+		} else if len(candidates) == 0 {
+			return entry, malformed
+		}
+	} else {
+		var tag string
+		tag, hexSum, entry.Name, ok = parseBsdSum(line)
+		if !ok {
+			return entry, malformed
+		}
+		entry.Tag = true
+		if entry.Algorithm, ok = LookupAlgorithm(tag); !ok {
+			return entry, fmt.Sprintf("unknown checksum algorithm %s", tag)
+		}
+		if len(hexSum) != entry.Algorithm.Size*2 {
+			return entry, malformed
+		}
+	}
+	if escaped {
+		entry.Name = UnescapeName(entry.Name)
+	}
+	var err error
+	if entry.Sum, err = hex.DecodeString(hexSum); err != nil {
+		return entry, malformed
+	}
+	return entry, ""
+}
+
+// algorithmForWidth finds the algorithm with digest of the given byte width.
+// The default algorithm takes precedence, otherwise all candidates are
+// returned if there are more than one.
+func (r *Reader) algorithmForWidth(width int) (algo Algorithm, candidates []string) {
+	if r.Default.Size == width {
+		return r.Default, []string{r.Default.Name}
+	}
+	for _, a := range Algorithms {
+		if a.Size == width {
+			algo = a
+			candidates = append(candidates, a.Name)
+		}
+	}
+	return
+}
+
+func isHexString(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if !('0' <= s[i] && s[i] <= '9' || 'a' <= s[i] && s[i] <= 'f' || 'A' <= s[i] && s[i] <= 'F') {
+			return false
+		}
+	}
+	return true
+}
+
+func parseGnuSum(line string) (hexSum string, file string, binary bool, ok bool) {
+	hexWidth := strings.IndexByte(line, ' ')
+	if hexWidth <= 0 || len(line) <= hexWidth+2 {
+		return
+	}
+	if line[hexWidth+1] != ' ' && line[hexWidth+1] != '*' {
+		return
+	}
+	return line[:hexWidth], line[hexWidth+2:], line[hexWidth+1] == '*', true
+}
+
+func parseBsdSum(line string) (tag string, hexSum string, file string, ok bool) {
+	tagWidth := strings.Index(line, " (")
+	hexStart := strings.LastIndex(line, ") = ") + 4
+	if tagWidth <= 0 || hexStart-4 <= tagWidth+2 || hexStart == len(line) {
+		return
+	}
+	return line[:tagWidth], line[hexStart:], line[tagWidth+2 : hexStart-4], true
+}
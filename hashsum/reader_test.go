@@ -0,0 +1,138 @@
+package hashsum
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestParseBsdSum(t *testing.T) {
+	digest := strings.Repeat("ab", 32)
+	tests := []struct {
+		line string
+		file string
+		ok   bool
+	}{
+		{"SHA256 (a.txt) = " + digest, "a.txt", true},
+		{"SHA256 (a (1).txt) = " + digest, "a (1).txt", true},
+		{"SHA512 (a.txt) = " + digest, "", false},
+		{"SHA256 a.txt) = " + digest, "", false},
+		{"SHA256 (a.txt) - " + digest, "", false},
+		{"SHA256 (a.txt) = " + digest[1:] + "g", "", false},
+	}
+	r := NewReader(strings.NewReader(""), "-")
+	for _, test := range tests {
+		entry, reason := r.parseLine(test.line)
+		ok := reason == ""
+		if ok != test.ok || ok && entry.Name != test.file {
+			t.Errorf("parseLine(%q) = %q, %v, want %q, %v", test.line, entry.Name, ok, test.file, test.ok)
+		} else if ok && hex.EncodeToString(entry.Sum) != digest {
+			t.Errorf("parseLine(%q) sum = %x", test.line, entry.Sum)
+		}
+	}
+}
+
+func TestParseLine(t *testing.T) {
+	sum32, sum64 := strings.Repeat("01", 32), strings.Repeat("ef", 64)
+	blake2b, _ := LookupAlgorithm("BLAKE2b")
+	tests := []struct {
+		line    string
+		def     Algorithm
+		algo    string
+		name    string
+		binary  bool
+		tag     bool
+		reason  string
+		badLine bool
+	}{
+		{line: sum32 + "  a", algo: "SHA256", name: "a"},
+		{line: sum32 + " *a b", algo: "SHA256", name: "a b", binary: true},
+		{line: strings.Repeat("0", 40) + "  a", algo: "SHA1", name: "a"},
+		{line: sum64 + "  a", reason: "checksum length is ambiguous, matching SHA512, BLAKE2b"},
+		{line: sum64 + "  a", def: blake2b, algo: "BLAKE2b", name: "a"},
+		{line: "SHA512 (a) = " + sum64, algo: "SHA512", name: "a", tag: true},
+		{line: "BLAKE2s-256 (a) = " + sum32, algo: "BLAKE2s", name: "a", tag: true},
+		{line: "MD5 (a) = " + sum32, reason: "unknown checksum algorithm MD5"},
+		{line: `\` + sum32 + `  a\nb\\c`, algo: "SHA256", name: "a\nb\\c"},
+		{line: `\SHA256 (a\\b) = ` + sum32, algo: "SHA256", name: `a\b`, tag: true},
+		{line: sum32 + "  ", badLine: true},
+		{line: sum32[1:] + "  a", badLine: true},
+		{line: sum32 + " -a", badLine: true},
+		{line: "SHA256 (a) = " + sum64, badLine: true},
+		{line: "", badLine: true},
+	}
+	for _, test := range tests {
+		r := NewReader(strings.NewReader(""), "-")
+		if test.def.Name != "" {
+			r.Default = test.def
+		}
+		entry, reason := r.parseLine(test.line)
+		if test.badLine {
+			if reason != malformed {
+				t.Errorf("parseLine(%q) reason = %q, want malformed", test.line, reason)
+			}
+			continue
+		}
+		if reason != test.reason {
+			t.Errorf("parseLine(%q) reason = %q, want %q", test.line, reason, test.reason)
+			continue
+		}
+		if reason != "" {
+			continue
+		}
+		if entry.Algorithm.Name != test.algo || entry.Name != test.name || entry.Binary != test.binary || entry.Tag != test.tag {
+			t.Errorf("parseLine(%q) = %s %q binary %v tag %v, want %s %q binary %v tag %v", test.line,
+				entry.Algorithm.Name, entry.Name, entry.Binary, entry.Tag, test.algo, test.name, test.binary, test.tag)
+		}
+	}
+}
+
+func TestReaderMixedFormats(t *testing.T) {
+	sum32 := strings.Repeat("01", 32)
+	input := sum32 + "  a\n" +
+		"garbage\n" +
+		"SHA1 (b) = " + strings.Repeat("0", 40) + "\r\n" +
+		"BLAKE2s (c) = " + sum32 + "\n"
+	r := NewReader(strings.NewReader(input), "sums")
+	r.CrLf = true
+	var names []string
+	var badLines []int
+	err := r.ForEach(func(entry Entry, err error) {
+		if err != nil {
+			badLines = append(badLines, err.(BadLineError).Line)
+			return
+		}
+		names = append(names, entry.Algorithm.Name+" "+entry.Name)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.Join(names, ", "), "SHA256 a, SHA1 b, BLAKE2s c"; got != want {
+		t.Errorf("entries = %s, want %s", got, want)
+	}
+	if len(badLines) != 1 || badLines[0] != 2 {
+		t.Errorf("bad lines = %v, want [2]", badLines)
+	}
+}
+
+func TestReaderZero(t *testing.T) {
+	sum32 := strings.Repeat("01", 32)
+	r := NewReader(strings.NewReader(sum32+"  a\nb\x00\\"+sum32+"  c\x00"), "sums")
+	r.Zero = true
+	var names []string
+	var badLines int
+	if err := r.ForEach(func(entry Entry, err error) {
+		if err != nil {
+			badLines++
+			return
+		}
+		names = append(names, entry.Name)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	// names aren't escaped with --zero, so a leading '\' is part of the
+	// digest
+	if len(names) != 1 || names[0] != "a\nb" || badLines != 1 {
+		t.Errorf("names = %q, %d bad lines, want [\"a\\nb\"], 1 bad line", names, badLines)
+	}
+}
@@ -1,4 +1,4 @@
-package main
+package hashsum
 
 import (
 	"bufio"
@@ -9,6 +9,9 @@ import (
 	"golang.org/x/text/encoding/unicode/utf32"
 )
 
+// TryToConvertToUTF8 detects UTF-8 with BOM, UTF-16 and UTF-32 input, with or
+// without BOM, by peeking at its first four bytes, and returns a reader
+// decoding it to UTF-8.  Any other input is returned as-is.
 func TryToConvertToUTF8(reader io.Reader) (r io.Reader) {
 	br := bufio.NewReader(reader)
 
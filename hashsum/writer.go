@@ -0,0 +1,41 @@
+package hashsum
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+)
+
+// Writer writes checksum lines.
+type Writer struct {
+	Algorithm Algorithm // algorithm name used in tag
+	Tag       bool      // bsd tag format or gnu format
+	Zero      bool      // '\0' as line separator or not
+	Binary    bool      // use '*' in gnu format or not
+}
+
+// Write writes the checksum line of a file to out.
+func (w Writer) Write(out io.Writer, sum []byte, name string) (err error) {
+	sep := "\n"
+	if w.Zero {
+		sep = "\x00"
+	}
+	prefix := ""
+	if !w.Zero {
+		var escaped bool
+		name, escaped = EscapeName(name)
+		if escaped {
+			prefix = `\`
+		}
+	}
+	if w.Tag {
+		_, err = fmt.Fprintf(out, "%s%s (%s) = %s%s", prefix, w.Algorithm.Name, name, hex.EncodeToString(sum), sep)
+	} else {
+		flag := ' '
+		if w.Binary {
+			flag = '*'
+		}
+		_, err = fmt.Fprintf(out, "%s%s %c%s%s", prefix, hex.EncodeToString(sum), flag, name, sep)
+	}
+	return
+}
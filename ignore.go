@@ -0,0 +1,57 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// IgnoreFileNames are read in each directory when honoring ignore files, a
+// later file takes precedence over an earlier one in the same directory.
+var IgnoreFileNames = []string{".gitignore", ".ignore", ".sha256signore"}
+
+// ignoreLevel holds patterns of ignore files in a directory, which are
+// relative to that directory and take precedence over those of its parents.
+type ignoreLevel struct {
+	base     string // slash separated path of the directory relative to the root
+	patterns PatternList
+	parent   *ignoreLevel
+}
+
+// loadIgnoreLevel reads ignore files in dir, and returns parent if there are
+// no patterns.
+func loadIgnoreLevel(dir string, rel string, names []string, parent *ignoreLevel) (*ignoreLevel, error) {
+	level := &ignoreLevel{base: rel, parent: parent}
+	for _, name := range names {
+		file, err := os.Open(filepath.Join(dir, name))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return parent, err
+		}
+		err = level.patterns.AddFromReader(file)
+		_ = file.Close()
+		if err != nil {
+			return parent, err
+		}
+	}
+	if len(level.patterns) == 0 {
+		return parent, nil
+	}
+	return level, nil
+}
+
+// Ignored reports whether a path relative to the root is ignored, deciding by
+// the deepest level with a matching pattern.
+func (l *ignoreLevel) Ignored(rel string, isDir bool) bool {
+	for ; l != nil; l = l.parent {
+		sub := rel
+		if l.base != "" {
+			sub = strings.TrimPrefix(rel, l.base+"/")
+		}
+		if excluded, matched := l.patterns.MatchLast(sub, isDir); matched {
+			return excluded
+		}
+	}
+	return false
+}
@@ -1,11 +1,17 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 	"unicode/utf8"
+
+	"github.com/erinacio/sha256s/engine"
 )
 
 var Version = "unknown"
@@ -27,20 +33,132 @@ func main() {
 		os.Exit(1)
 	}
 
-	if opt.Check {
+	if opt.Keygen {
+		if err := GenerateKeys(opt.PublicKey, opt.SecretKey); err != nil {
+			logError(err)
+			os.Exit(1)
+		}
+	} else if opt.Check {
 		checkMain(opt)
+	} else if opt.XattrVerify {
+		xattrVerifyMain(opt)
+	} else if opt.Update != "" {
+		updateMain(opt)
+	} else if opt.Diff {
+		diffMain(opt)
+	} else if opt.FindDups {
+		findDuplicatesMain(opt)
 	} else {
 		hashMain(opt)
 	}
 }
 
+// newEngine makes the hashing engine for the options, exiting on failure.
+func newEngine(opt Options) engine.Engine {
+	e := engine.Engine{
+		Jobs:       opt.Jobs,
+		Algorithm:  opt.Algo,
+		Open:       OpenFile,
+		IO:         opt.IO,
+		BufferSize: int(opt.BufferSize),
+		HardLinks:  opt.HardLinks || opt.FirstLink,
+	}
+	if opt.Cache != "" {
+		cache, err := engine.LoadCache(opt.Cache)
+		if err != nil {
+			logError(err)
+			os.Exit(1)
+		}
+		cache.Rehash = opt.Rehash
+		e.Cache = cache
+	}
+	if opt.Verbose {
+		e.Stats = &engine.IOStats{}
+	}
+	if opt.BwLimit > 0 {
+		e.Limiter = engine.NewRateLimiter(int64(opt.BwLimit))
+	}
+	if opt.BwLimitFile > 0 {
+		e.FileLimiter = engine.NewRateLimiter(int64(opt.BwLimitFile))
+	}
+	if e.Limiter != nil || e.FileLimiter != nil {
+		watchRateSignals(e.Limiter, e.FileLimiter)
+	}
+	if opt.Progress || opt.ProgressFD >= 0 {
+		e.Progress = &engine.Progress{}
+	}
+	return e
+}
+
+// signalContext returns a context which is done on SIGINT or SIGTERM, so that
+// hashing stops and results so far are handled.  A second signal terminates
+// at once.
+func signalContext() context.Context {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	return ctx
+}
+
+// interrupted reports whether ctx is done, logging it if so.
+func interrupted(ctx context.Context) bool {
+	if ctx.Err() == nil {
+		return false
+	}
+	log.Print("interrupted")
+	return true
+}
+
+// canceled reports whether err is the cancellation of an interrupted run,
+// which isn't reported for each file.
+func canceled(ctx context.Context, err error) bool {
+	return err != nil && ctx.Err() != nil && errors.Is(err, ctx.Err())
+}
+
+// sendJob sends a job unless ctx is done first, it reports whether the job
+// was sent.
+func sendJob(ctx context.Context, jobCh chan<- engine.Job, job engine.Job) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case jobCh <- job:
+		return true
+	}
+}
+
+// finishEngine saves the cache and reports the throughput of the engine, ok
+// is false if the cache can't be saved.
+func finishEngine(opt Options, e engine.Engine) (ok bool) {
+	if e.Stats != nil {
+		for _, strategy := range []engine.IOStrategy{engine.IORead, engine.IOMmap} {
+			if st := e.Stats.Get(strategy); st.Files > 0 {
+				log.Printf("%s: %d %s, %.1f MiB in %.3fs, %.1f MiB/s per job", strategy, st.Files, iif(st.Files == 1, "file", "files"),
+					float64(st.Bytes)/(1<<20), st.Duration.Seconds(), st.Throughput()/(1<<20))
+			}
+		}
+	}
+	if e.Cache != nil {
+		if err := e.Cache.Save(opt.Cache); err != nil {
+			logError(err)
+			return false
+		}
+	}
+	return true
+}
+
 func logError(err error) {
+	log.Printf("%s", errorMessage(err))
+}
+
+func errorMessage(err error) string {
 	if pe, ok := err.(*os.PathError); ok {
 		errMsg := pe.Err.Error()
 		_, size := utf8.DecodeRuneInString(errMsg)
 		errMsg = strings.ToTitle(errMsg[:size]) + errMsg[size:]
-		log.Printf("%s: %s", pe.Path, errMsg)
+		return fmt.Sprintf("%s: %s", pe.Path, errMsg)
 	} else {
-		log.Printf("%v", err)
+		return err.Error()
 	}
 }
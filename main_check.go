@@ -2,28 +2,36 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
-	"sync"
-	"sync/atomic"
 
-	"github.com/minio/sha256-simd"
+	"github.com/erinacio/sha256s/engine"
+	"github.com/erinacio/sha256s/hashsum"
 )
 
 type checksumLine struct {
 	ArgI int
+	Line int
 	Name string
 	Sum  []byte
 }
 
 type checkResult struct {
-	ArgI int
-	Name string
-	Stat string
+	ArgI     int
+	Line     int
+	Name     string
+	Algo     string
+	Stat     string
+	Expected []byte
+	Actual   []byte
+	Err      error
 }
 
 func checkMain(opt Options) {
@@ -31,71 +39,231 @@ func checkMain(opt Options) {
 		log.SetOutput(ioutil.Discard)
 		_ = os.Stdout.Close()
 	}
-	lineCh := make(chan checksumLine)
-	checkCh := make(chan checkResult)
-
-	var checkWg sync.WaitGroup
-	checkWg.Add(opt.Jobs)
-	go func() {
-		checkWg.Wait()
-		close(checkCh)
-	}()
-
-	var badLinesCount, badFilesCount, errorsCount, mismatchCount int64
-	go readSumWorker(opt, lineCh, &badLinesCount, &errorsCount)
-	for range make([]struct{}, opt.Jobs) {
-		go checkWorker(&checkWg, opt, lineCh, checkCh, &badFilesCount)
+	ctx := signalContext()
+	var key *PublicKey
+	if opt.PublicKey != "" {
+		var err error
+		if key, err = LoadPublicKey(opt.PublicKey); err != nil {
+			logError(err)
+			os.Exit(1)
+		}
 	}
+	lineCh := make(chan engine.Job)
+	go readSumWorker(ctx, opt, key, lineCh)
+	eng := newEngine(opt)
+	if opt.Prescan {
+		go prescanManifests(opt, eng.Progress)
+	}
+	progress := startProgress(opt, eng.Progress)
+	stats := newRunStats(opt)
+	resultCh := eng.Run(ctx, lineCh)
 
+	var report *CheckReport
+	if opt.Report == ReportJSON {
+		report = &CheckReport{}
+	}
+	var badLinesCount, badFilesCount, errorsCount, mismatchCount, untrackedCount int64
 	noFileVerifiedSet, fileVerifiedSet := make(map[int]struct{}), make(map[int]struct{}, len(opt.Paths))
-	for result := range checkCh {
-		if result.Stat == "" {
-			if _, ok := fileVerifiedSet[result.ArgI]; !ok {
-				noFileVerifiedSet[result.ArgI] = struct{}{}
+	tracked := make(map[string]struct{})
+	reorderer := Reorderer{
+		Sort: opt.Sort,
+		Emit: func(v interface{}) {
+			result := v.(checkResult)
+			if canceled(ctx, result.Err) {
+				return
+			}
+			if opt.Untracked != "" && result.Expected != nil {
+				tracked[trackedKey(opt, result.Name)] = struct{}{}
+			}
+			if result.Stat == "" && result.Err != nil {
+				if _, ok := result.Err.(hashsum.BadLineError); ok {
+					if report != nil {
+						report.AddEntry(opt, result)
+					} else if opt.Warn {
+						logError(result.Err)
+					}
+					stats.AddError(result.Err)
+					badLinesCount++
+				} else {
+					if report != nil {
+						report.AddError(result.Err)
+					} else {
+						logError(result.Err)
+					}
+					stats.AddError(result.Err)
+					errorsCount++
+				}
+				return
+			}
+			if result.Stat == "" {
+				if _, ok := fileVerifiedSet[result.ArgI]; !ok {
+					noFileVerifiedSet[result.ArgI] = struct{}{}
+				}
+				return
+			}
+			if _, ok := noFileVerifiedSet[result.ArgI]; ok {
+				delete(noFileVerifiedSet, result.ArgI)
 			}
-			continue
-		}
-		if _, ok := noFileVerifiedSet[result.ArgI]; ok {
-			delete(noFileVerifiedSet, result.ArgI)
 			fileVerifiedSet[result.ArgI] = struct{}{}
-		}
-		if strings.IndexByte(result.Name, '\n') >= 0 {
-			result.Name, _ = escapeName(result.Name)
-			result.Name = `\` + result.Name
-		}
-		if result.Stat == "OK" {
-			if !opt.Quiet {
+			if result.Err != nil {
+				stats.AddError(result.Err)
+				badFilesCount++
+			}
+			if result.Stat == "FAILED" {
+				stats.Count("mismatch")
+				mismatchCount++
+			}
+			if report != nil {
+				report.AddEntry(opt, result)
+				return
+			}
+			if result.Err != nil {
+				logError(result.Err)
+			}
+			result.Name = escapeStatusName(result.Name)
+			if result.Stat == "OK" {
+				if !opt.Quiet {
+					fmt.Printf("%s: %s\n", result.Name, result.Stat)
+				}
+			} else {
 				fmt.Printf("%s: %s\n", result.Name, result.Stat)
 			}
-		} else if result.Stat == "FAILED" {
-			mismatchCount++
-			fmt.Printf("%s: %s\n", result.Name, result.Stat)
-		} else {
-			fmt.Printf("%s: %s\n", result.Name, result.Stat)
+		},
+	}
+	for result := range resultCh {
+		checkResult := toCheckResult(opt, result)
+		stats.Add(result)
+		reorderer.Put(result.Seq, checkResult.Name, checkResult)
+	}
+	reorderer.Flush()
+	progress.Stop()
+
+	if opt.Untracked != "" && ctx.Err() == nil {
+		untracked := Reorderer{
+			Sort: opt.Sort,
+			Emit: func(v interface{}) {
+				name := v.(string)
+				stats.Count("untracked")
+				untrackedCount++
+				if report != nil {
+					report.Untracked = append(report.Untracked, newPathRecord(name))
+				} else {
+					fmt.Printf("%s: UNTRACKED\n", escapeStatusName(name))
+				}
+			},
 		}
+		var seq int
+		checksumFiles := checksumFileInfos(opt)
+		walker := Walker{MaxDepth: -1}
+		walker.FindRegularFiles(opt.Untracked, func(name string, err error) {
+			if err != nil {
+				if report != nil {
+					report.AddError(err)
+				} else {
+					logError(err)
+				}
+				stats.AddError(err)
+				errorsCount++
+				return
+			}
+			if _, ok := tracked[trackedKey(opt, outputName(opt, name))]; ok || isChecksumFile(checksumFiles, name) {
+				return
+			}
+			name = outputName(opt, name)
+			untracked.Put(seq, name, name)
+			seq++
+		})
+		untracked.Flush()
 	}
 
-	for i := range noFileVerifiedSet {
-		atomic.AddInt64(&errorsCount, 1)
-		log.Printf("%s: no file was verified", opt.Paths[i])
+	for _, i := range sortedKeys(noFileVerifiedSet) {
+		stats.Count("no file verified")
+		errorsCount++
+		if report != nil {
+			report.AddError(fmt.Errorf("%s: no file was verified", opt.Paths[i]))
+		} else {
+			log.Printf("%s: no file was verified", opt.Paths[i])
+		}
 	}
-	if c := atomic.LoadInt64(&badLinesCount); c > 0 {
+	if report != nil {
+		report.Counters = CheckReportCounters{
+			BadLines:   badLinesCount,
+			BadFiles:   badFilesCount,
+			Errors:     errorsCount,
+			Mismatches: mismatchCount,
+			Untracked:  untrackedCount,
+		}
+		_ = report.Write(os.Stdout)
+	} else if c := badLinesCount; c > 0 {
 		log.Printf("WARNING: %d %s improperly formatted", c, iif(c == 1, "line is", "lines are"))
 	}
-	if c := atomic.LoadInt64(&badFilesCount); c > 0 {
+	if c := badFilesCount; c > 0 && report == nil {
 		log.Printf("WARNING: %d listed %s could not be read", c, iif(c == 1, "file", "files"))
 	}
-	if c := mismatchCount; c > 0 {
+	if c := mismatchCount; c > 0 && report == nil {
 		log.Printf("WARNING: %d computed %s did not match", c, iif(c == 1, "checksum", "checksums"))
 	}
-	if (opt.Strict && atomic.LoadInt64(&badLinesCount) != 0) ||
-		atomic.LoadInt64(&badFilesCount) != 0 ||
-		atomic.LoadInt64(&errorsCount) != 0 ||
+	if c := untrackedCount; c > 0 && report == nil {
+		log.Printf("WARNING: %d %s not listed in any checksum file", c, iif(c == 1, "file is", "files are"))
+	}
+	stats.Report()
+	if !finishEngine(opt, eng) || interrupted(ctx) ||
+		(opt.FailUntracked && untrackedCount != 0) ||
+		(opt.Strict && badLinesCount != 0) ||
+		badFilesCount != 0 ||
+		errorsCount != 0 ||
 		mismatchCount != 0 {
 		os.Exit(1)
 	}
 }
 
+// trackedKey returns the absolute path of a listed file, so that listed and
+// walked names can be compared.
+func trackedKey(opt Options, name string) string {
+	if !opt.NativePath {
+		name = fromUnixPath(name)
+	}
+	if abs, err := filepath.Abs(name); err == nil {
+		return abs
+	}
+	return filepath.Clean(name)
+}
+
+// checksumFileInfos returns the infos of the checksum files, their caches
+// kept by --update and their signatures which exist.
+func checksumFileInfos(opt Options) (infos []os.FileInfo) {
+	paths := append([]string{}, opt.Paths...)
+	for _, path := range opt.Paths {
+		paths = append(paths, path+".cache")
+		if opt.PublicKey != "" {
+			paths = append(paths, path+".sig")
+		}
+	}
+	if opt.PublicKey != "" {
+		paths = append(paths, opt.Signature)
+	}
+	for _, path := range paths {
+		if info, err := os.Stat(path); err == nil {
+			infos = append(infos, info)
+		}
+	}
+	return
+}
+
+// isChecksumFile reports whether a file is one of checksumFileInfos.
+func isChecksumFile(infos []os.FileInfo, name string) bool {
+	info, err := os.Stat(name)
+	if err != nil {
+		return false
+	}
+	for _, pathInfo := range infos {
+		if os.SameFile(info, pathInfo) {
+			return true
+		}
+	}
+	return false
+}
+
 func iif(b bool, t, f string) string {
 	if b {
 		return t
@@ -104,76 +272,106 @@ func iif(b bool, t, f string) string {
 	}
 }
 
-func readSumWorker(opt Options, lineCh chan<- checksumLine, badLinesCount *int64, errorsCount *int64) {
-	defer close(lineCh)
-	reader := HashSumReader{
-		Name:  "SHA256",
-		Width: sha256.Size,
-		Tag:   opt.Tag,
-		Zero:  opt.Zero,
-		CrLf:  opt.CrLf,
+func sortedKeys(set map[int]struct{}) []int {
+	keys := make([]int, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
 	}
+	sort.Ints(keys)
+	return keys
+}
+
+// readSumWorker sends a job for each line of the checksum files, and for each
+// error of the files themselves, until ctx is done.  If key isn't nil, no line
+// is sent from a file unless its signature is verified first.
+func readSumWorker(ctx context.Context, opt Options, key *PublicKey, lineCh chan<- engine.Job) {
+	defer close(lineCh)
 	for i, path := range opt.Paths {
-		reader.Read(path, func(sum []byte, name string, err error) {
+		if ctx.Err() != nil {
+			return
+		}
+		file, err := OpenFile(path)
+		if err != nil {
+			sendJob(ctx, lineCh, engine.Job{Name: path, Data: checksumLine{ArgI: i, Name: path}, Err: err})
+			continue
+		}
+		var rd io.Reader = file
+		if key != nil {
+			var content []byte
+			content, err = ioutil.ReadAll(file)
 			if err == nil {
-				lineCh <- checksumLine{
-					ArgI: i,
-					Name: name,
-					Sum:  sum,
-				}
-			} else if _, ok := err.(BadLineError); ok {
-				if opt.Warn {
-					logError(err)
-				}
-				atomic.AddInt64(badLinesCount, 1)
-			} else {
-				logError(err)
-				atomic.AddInt64(errorsCount, 1)
+				content, err = verifyManifest(key, path, content, opt.Signature)
 			}
-		})
-	}
-}
-
-func checkWorker(wg *sync.WaitGroup, opt Options, lineCh <-chan checksumLine, checkCh chan<- checkResult, badFilesCount *int64) {
-	defer wg.Done()
-	hash := sha256.New()
-	for line := range lineCh {
-		var name string
-		if opt.NativePath {
-			name = line.Name
-		} else {
-			name = fromUnixPath(name)
+			if err != nil {
+				_ = file.Close()
+				sendJob(ctx, lineCh, engine.Job{Name: path, Data: checksumLine{ArgI: i, Name: path}, Err: err})
+				continue
+			}
+			rd = bytes.NewReader(content)
 		}
-		sum, err := fileHash(hash, line.Name)
-		if opt.IgnoreMissing && os.IsNotExist(err) {
-			checkCh <- checkResult{
-				ArgI: line.ArgI,
-				Name: line.Name,
+		reader := hashsum.NewReader(rd, path)
+		reader.Default = opt.Algo
+		reader.Zero = opt.Zero
+		reader.CrLf = opt.CrLf
+		var validLineCount uint64
+		err = reader.ForEach(func(entry hashsum.Entry, err error) {
+			if err == nil && entry.Name == "-" && path == "-" {
+				err = hashsum.BadLineError{Path: path, Line: entry.Line}
 			}
-		} else if err != nil {
-			logError(err)
-			checkCh <- checkResult{
-				ArgI: line.ArgI,
-				Name: line.Name,
-				Stat: "FAILED open or read",
-			}
-			atomic.AddInt64(badFilesCount, 1)
-		} else if bytes.Equal(sum, line.Sum) {
-			checkCh <- checkResult{
-				ArgI: line.ArgI,
-				Name: line.Name,
-				Stat: "OK",
+			if err != nil {
+				sendJob(ctx, lineCh, engine.Job{Name: path, Data: checksumLine{ArgI: i, Line: entry.Line, Name: path}, Err: err})
+				return
 			}
-		} else {
-			checkCh <- checkResult{
-				ArgI: line.ArgI,
-				Name: line.Name,
-				Stat: "FAILED",
+			name := entry.Name
+			if !opt.NativePath {
+				name = fromUnixPath(name)
+			}
+			job := engine.Job{
+				Name:      name,
+				Algorithm: entry.Algorithm,
+				Data:      checksumLine{ArgI: i, Line: entry.Line, Name: entry.Name, Sum: entry.Sum},
 			}
+			if sendJob(ctx, lineCh, job) {
+				validLineCount++
+			}
+		})
+		_ = file.Close()
+		if ctx.Err() != nil {
+			return
+		} else if err != nil {
+			sendJob(ctx, lineCh, engine.Job{Name: path, Data: checksumLine{ArgI: i, Name: path}, Err: err})
+		} else if validLineCount == 0 {
+			err = fmt.Errorf("%s: no properly formatted checksum lines found", path)
+			sendJob(ctx, lineCh, engine.Job{Name: path, Data: checksumLine{ArgI: i, Name: path}, Err: err})
 		}
 	}
 }
 
+// toCheckResult turns a hash result into a check result.  Errors of the
+// checksum files themselves are left with empty Stat.
+func toCheckResult(opt Options, result engine.Result) checkResult {
+	line := result.Data.(checksumLine)
+	r := checkResult{
+		ArgI:     line.ArgI,
+		Line:     line.Line,
+		Name:     line.Name,
+		Algo:     result.Algorithm.Name,
+		Expected: line.Sum,
+	}
+	switch {
+	case line.Sum == nil:
+		r.Err = result.Err
+	case opt.IgnoreMissing && os.IsNotExist(result.Err):
+	case result.Err != nil:
+		r.Stat, r.Err = "FAILED open or read", result.Err
+	case bytes.Equal(result.Sum, line.Sum):
+		r.Stat = "OK"
+	default:
+		r.Stat, r.Actual = "FAILED", result.Sum
+	}
+	return r
+}
+
 func fromUnixPath(nativePath string) (unixPath string) {
 	if filepath.Separator == '/' {
 		return nativePath
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+
+	"github.com/erinacio/sha256s/hashsum"
+)
+
+const (
+	DiffAdded    = "added"
+	DiffRemoved  = "removed"
+	DiffModified = "modified"
+	DiffRenamed  = "renamed"
+)
+
+type diffEntry struct {
+	Status string
+	Old    *hashsum.Entry // nil if added
+	New    *hashsum.Entry // nil if removed
+}
+
+func (d diffEntry) Name() string {
+	if d.New != nil {
+		return d.New.Name
+	}
+	return d.Old.Name
+}
+
+type diffRecord struct {
+	Status string `json:"status"`
+	pathRecord
+	OldPath       string `json:"old_path,omitempty"`
+	OldPathBase64 []byte `json:"old_path_base64,omitempty"`
+	Algorithm     string `json:"algorithm,omitempty"`
+	Digest        string `json:"digest,omitempty"`
+	OldAlgorithm  string `json:"old_algorithm,omitempty"`
+	OldDigest     string `json:"old_digest,omitempty"`
+}
+
+// newDiffRecord makes a record of a difference, the path of a removed entry
+// is its old one, and old_path is set only for renamed entries.
+func newDiffRecord(d diffEntry) diffRecord {
+	rec := diffRecord{Status: d.Status, pathRecord: newPathRecord(d.Name())}
+	if d.New != nil {
+		rec.Algorithm, rec.Digest = d.New.Algorithm.Name, hex.EncodeToString(d.New.Sum)
+	}
+	if d.Old != nil {
+		rec.OldAlgorithm, rec.OldDigest = d.Old.Algorithm.Name, hex.EncodeToString(d.Old.Sum)
+	}
+	if d.Status == DiffRenamed {
+		old := newPathRecord(d.Old.Name)
+		rec.OldPath, rec.OldPathBase64 = old.Path, old.PathBase64
+	}
+	return rec
+}
+
+// diffMain compares two checksum files, exiting with 0 if they are the same,
+// 1 if they differ, and 2 on trouble, like diff(1).
+func diffMain(opt Options) {
+	var manifests [2][]hashsum.Entry
+	var badLinesCount int64
+	for i, path := range opt.Paths {
+		entries, badLines, err := readManifest(opt, path, opt.Warn)
+		if err != nil {
+			logError(err)
+			os.Exit(2)
+		}
+		manifests[i] = entries
+		badLinesCount += badLines
+	}
+
+	diffs := diffManifests(manifests[0], manifests[1])
+	recordWriter := RecordWriter{Out: os.Stdout, NDJSON: opt.Format == FormatNDJSON}
+	for _, d := range diffs {
+		if opt.Format != FormatText {
+			_ = recordWriter.Write(newDiffRecord(d))
+		} else if d.Status == DiffRenamed {
+			fmt.Printf("%s: %s from %s\n", escapeStatusName(d.New.Name), d.Status, escapeStatusName(d.Old.Name))
+		} else {
+			fmt.Printf("%s: %s\n", escapeStatusName(d.Name()), d.Status)
+		}
+	}
+	if opt.Format != FormatText {
+		_ = recordWriter.Close()
+	}
+
+	if c := badLinesCount; c > 0 {
+		log.Printf("WARNING: %d %s improperly formatted", c, iif(c == 1, "line is", "lines are"))
+	}
+	if opt.Strict && badLinesCount != 0 {
+		os.Exit(2)
+	}
+	if len(diffs) != 0 {
+		os.Exit(1)
+	}
+}
+
+// diffManifests compares entries by name.  Removed and added entries with the
+// same algorithm and digest are paired in order as renamed ones.  The result
+// is sorted by name, the new one for renamed entries.  Only the first entry
+// of a name in each manifest is used.
+func diffManifests(oldEntries, newEntries []hashsum.Entry) (diffs []diffEntry) {
+	oldByName := indexEntries(oldEntries)
+	newByName := indexEntries(newEntries)
+
+	var removed []*hashsum.Entry
+	for i := range oldEntries {
+		old := &oldEntries[i]
+		if oldByName[old.Name] != old {
+			continue
+		}
+		cur, ok := newByName[old.Name]
+		switch {
+		case !ok:
+			removed = append(removed, old)
+		case cur.Algorithm.Name != old.Algorithm.Name || !bytes.Equal(cur.Sum, old.Sum):
+			diffs = append(diffs, diffEntry{Status: DiffModified, Old: old, New: cur})
+		}
+	}
+
+	added := make(map[string][]*hashsum.Entry)
+	var addedOrder []*hashsum.Entry
+	for i := range newEntries {
+		cur := &newEntries[i]
+		if _, ok := oldByName[cur.Name]; ok || newByName[cur.Name] != cur {
+			continue
+		}
+		key := digestKey(cur)
+		added[key] = append(added[key], cur)
+		addedOrder = append(addedOrder, cur)
+	}
+	renamed := make(map[*hashsum.Entry]bool)
+	for _, old := range removed {
+		key := digestKey(old)
+		if candidates := added[key]; len(candidates) > 0 {
+			added[key] = candidates[1:]
+			renamed[candidates[0]] = true
+			diffs = append(diffs, diffEntry{Status: DiffRenamed, Old: old, New: candidates[0]})
+		} else {
+			diffs = append(diffs, diffEntry{Status: DiffRemoved, Old: old})
+		}
+	}
+	for _, cur := range addedOrder {
+		if !renamed[cur] {
+			diffs = append(diffs, diffEntry{Status: DiffAdded, New: cur})
+		}
+	}
+
+	sort.SliceStable(diffs, func(i, j int) bool { return diffs[i].Name() < diffs[j].Name() })
+	return
+}
+
+func indexEntries(entries []hashsum.Entry) map[string]*hashsum.Entry {
+	byName := make(map[string]*hashsum.Entry, len(entries))
+	for i := range entries {
+		if _, ok := byName[entries[i].Name]; !ok {
+			byName[entries[i].Name] = &entries[i]
+		}
+	}
+	return byName
+}
+
+func digestKey(entry *hashsum.Entry) string {
+	return entry.Algorithm.Name + " " + string(entry.Sum)
+}
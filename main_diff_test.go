@@ -0,0 +1,89 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/erinacio/sha256s/hashsum"
+)
+
+func diffTestEntries(lines ...string) []hashsum.Entry {
+	var entries []hashsum.Entry
+	for _, line := range lines {
+		fields := strings.SplitN(line, " ", 2)
+		entries = append(entries, hashsum.Entry{
+			Algorithm: hashsum.DefaultAlgorithm,
+			Sum:       []byte(fields[0]),
+			Name:      fields[1],
+		})
+	}
+	return entries
+}
+
+func TestDiffManifests(t *testing.T) {
+	tests := []struct {
+		name     string
+		old, new []hashsum.Entry
+		want     []string
+	}{
+		{
+			name: "same",
+			old:  diffTestEntries("1 a", "2 b"),
+			new:  diffTestEntries("2 b", "1 a"),
+		},
+		{
+			name: "added, removed and modified",
+			old:  diffTestEntries("1 a", "2 b", "3 c"),
+			new:  diffTestEntries("1 a", "9 b", "4 d"),
+			want: []string{"modified b", "removed c", "added d"},
+		},
+		{
+			name: "renamed",
+			old:  diffTestEntries("1 a", "2 b"),
+			new:  diffTestEntries("1 a", "2 c"),
+			want: []string{"renamed b c"},
+		},
+		{
+			name: "each removed file is renamed once",
+			old:  diffTestEntries("2 a", "2 b"),
+			new:  diffTestEntries("2 c", "2 d", "2 e"),
+			want: []string{"renamed a c", "renamed b d", "added e"},
+		},
+		{
+			name: "copy isn't a rename",
+			old:  diffTestEntries("2 a"),
+			new:  diffTestEntries("2 a", "2 b"),
+			want: []string{"added b"},
+		},
+		{
+			name: "first duplicate line wins",
+			old:  diffTestEntries("1 a", "2 a"),
+			new:  diffTestEntries("1 a"),
+		},
+	}
+	for _, test := range tests {
+		var got []string
+		for _, d := range diffManifests(test.old, test.new) {
+			s := d.Status + " " + d.Name()
+			if d.Status == DiffRenamed {
+				s = d.Status + " " + d.Old.Name + " " + d.New.Name
+			}
+			got = append(got, s)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: diff = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestDiffManifestsAlgorithmChange(t *testing.T) {
+	blake2s, _ := hashsum.LookupAlgorithm("BLAKE2s")
+	old := diffTestEntries("1 a")
+	cur := diffTestEntries("1 a")
+	cur[0].Algorithm = blake2s
+	diffs := diffManifests(old, cur)
+	if len(diffs) != 1 || diffs[0].Status != DiffModified {
+		t.Errorf("diff = %v, want a modified entry", diffs)
+	}
+}
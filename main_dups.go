@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+
+	"github.com/erinacio/sha256s/engine"
+	"github.com/erinacio/sha256s/hashsum"
+)
+
+// Files of the same size are compared by a hash of this many leading bytes
+// before being hashed in full.
+const partialHashSize = 4 << 10
+
+type dupFile struct {
+	Name    string // native path
+	Info    os.FileInfo
+	Partial []byte
+	Sum     []byte
+}
+
+type duplicateRecord struct {
+	Algorithm string       `json:"algorithm"`
+	Digest    string       `json:"digest"`
+	Size      int64        `json:"size"`
+	Wasted    int64        `json:"wasted"`
+	Files     []pathRecord `json:"files"`
+}
+
+func findDuplicatesMain(opt Options) {
+	ctx := signalContext()
+	jobCh := make(chan engine.Job)
+	go walkWorker(ctx, opt, jobCh)
+
+	var errorsCount int64
+	var files []*dupFile
+	for job := range jobCh {
+		var info os.FileInfo
+		if canceled(ctx, job.Err) {
+			continue
+		} else if isSkipped(job.Err) {
+			log.Print(job.Err)
+			continue
+		} else if job.Err == nil {
+			info, job.Err = os.Stat(job.Name)
+		}
+		if job.Err != nil {
+			logError(job.Err)
+			errorsCount++
+			continue
+		}
+		if info.Mode().IsRegular() && info.Size() > 0 {
+			files = append(files, &dupFile{Name: job.Name, Info: info})
+		}
+	}
+	if opt.Sort {
+		sort.SliceStable(files, func(i, j int) bool { return toUnixPath(files[i].Name) < toUnixPath(files[j].Name) })
+	}
+
+	eng := newEngine(opt)
+	eng.HardLinks = true
+	files = flatten(groupDuplicates(files, func(f *dupFile) string {
+		return fmt.Sprint(f.Info.Size())
+	}))
+	errorsCount += hashDuplicates(ctx, eng, files, true)
+	files = flatten(groupDuplicates(hashed(files, true), func(f *dupFile) string {
+		return fmt.Sprintf("%d %x", f.Info.Size(), f.Partial)
+	}))
+	var large []*dupFile
+	for _, f := range files {
+		if f.Info.Size() <= partialHashSize {
+			f.Sum = f.Partial
+		} else {
+			large = append(large, f)
+		}
+	}
+	errorsCount += hashDuplicates(ctx, eng, large, false)
+	groups := groupDuplicates(hashed(files, false), func(f *dupFile) string {
+		return fmt.Sprintf("%d %x", f.Info.Size(), f.Sum)
+	})
+
+	writer := hashsum.Writer{Algorithm: opt.Algo, Tag: opt.Tag, Binary: opt.Binary}
+	recordWriter := RecordWriter{Out: os.Stdout, NDJSON: opt.Format == FormatNDJSON}
+	var totalWasted int64
+	for i, group := range groups {
+		size := group[0].Info.Size()
+		wasted := size * int64(distinctFiles(group)-1)
+		totalWasted += wasted
+		if opt.Format != FormatText {
+			rec := duplicateRecord{
+				Algorithm: opt.Algo.Name,
+				Digest:    hex.EncodeToString(group[0].Sum),
+				Size:      size,
+				Wasted:    wasted,
+			}
+			for _, f := range group {
+				rec.Files = append(rec.Files, newPathRecord(outputName(opt, f.Name)))
+			}
+			_ = recordWriter.Write(rec)
+			continue
+		}
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Printf("%d files of %d bytes, %d bytes wasted\n", len(group), size, wasted)
+		for _, f := range group {
+			_ = writer.Write(os.Stdout, f.Sum, outputName(opt, f.Name))
+		}
+	}
+	if opt.Format != FormatText {
+		_ = recordWriter.Close()
+	}
+	if c := len(groups); c > 0 {
+		log.Printf("%d %s of duplicates, %d bytes wasted", c, iif(c == 1, "group", "groups"), totalWasted)
+	}
+
+	if opt.Dedupe != "" && ctx.Err() == nil {
+		var replacedCount int64
+		for _, group := range groups {
+			for _, f := range group[1:] {
+				if os.SameFile(group[0].Info, f.Info) {
+					continue
+				}
+				if err := replaceDuplicate(opt.Dedupe, group[0].Name, f.Name); err != nil {
+					logError(err)
+					errorsCount++
+				} else {
+					replacedCount++
+				}
+			}
+		}
+		if c := replacedCount; c > 0 {
+			log.Printf("%d %s replaced with %ss", c, iif(c == 1, "duplicate", "duplicates"), opt.Dedupe)
+		}
+	}
+
+	if !finishEngine(opt, eng) || interrupted(ctx) || errorsCount > 0 {
+		os.Exit(1)
+	}
+}
+
+// hashDuplicates hashes files, or their leading bytes if partial.  Files
+// which can't be read are reported and left without a digest.
+func hashDuplicates(ctx context.Context, eng engine.Engine, files []*dupFile, partial bool) (errorsCount int64) {
+	src := make(chan engine.Job)
+	go func() {
+		defer close(src)
+		for i, f := range files {
+			job := engine.Job{Name: f.Name, Data: i}
+			if partial {
+				name := f.Name
+				job.Open = func() (io.ReadCloser, error) { return openPartial(name) }
+			}
+			if !sendJob(ctx, src, job) {
+				return
+			}
+		}
+	}()
+	reorderer := Reorderer{
+		Emit: func(v interface{}) {
+			result := v.(engine.Result)
+			if canceled(ctx, result.Err) {
+				return
+			} else if result.Err != nil {
+				logError(result.Err)
+				errorsCount++
+			} else if f := files[result.Data.(int)]; partial {
+				f.Partial = result.Sum
+			} else {
+				f.Sum = result.Sum
+			}
+		},
+	}
+	for result := range eng.Run(ctx, src) {
+		reorderer.Put(result.Seq, result.Name, result)
+	}
+	reorderer.Flush()
+	return
+}
+
+type partialFile struct {
+	io.Reader
+	io.Closer
+}
+
+func openPartial(name string) (io.ReadCloser, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return partialFile{Reader: io.LimitReader(file, partialHashSize), Closer: file}, nil
+}
+
+// hashed returns files which have a partial or full digest.
+func hashed(files []*dupFile, partial bool) (ok []*dupFile) {
+	for _, f := range files {
+		if (partial && f.Partial != nil) || (!partial && f.Sum != nil) {
+			ok = append(ok, f)
+		}
+	}
+	return
+}
+
+// groupDuplicates groups files by key in order of their first file, leaving
+// out groups of hard links to a single file.
+func groupDuplicates(files []*dupFile, key func(f *dupFile) string) (groups [][]*dupFile) {
+	index := make(map[string]int)
+	for _, f := range files {
+		k := key(f)
+		if i, ok := index[k]; ok {
+			groups[i] = append(groups[i], f)
+		} else {
+			index[k] = len(groups)
+			groups = append(groups, []*dupFile{f})
+		}
+	}
+	n := 0
+	for _, group := range groups {
+		if distinctFiles(group) > 1 {
+			groups[n] = group
+			n++
+		}
+	}
+	return groups[:n]
+}
+
+// distinctFiles counts files in a group which aren't hard links to each other.
+func distinctFiles(group []*dupFile) (n int) {
+outer:
+	for i, f := range group {
+		for _, g := range group[:i] {
+			if os.SameFile(f.Info, g.Info) {
+				continue outer
+			}
+		}
+		n++
+	}
+	return
+}
+
+func flatten(groups [][]*dupFile) (files []*dupFile) {
+	for _, group := range groups {
+		files = append(files, group...)
+	}
+	return
+}
@@ -1,95 +1,162 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"log"
 	"os"
 	"path/filepath"
 	"strings"
-	"sync"
-	"sync/atomic"
 
-	"github.com/minio/sha256-simd"
+	"github.com/erinacio/sha256s/engine"
+	"github.com/erinacio/sha256s/hashsum"
 )
 
-type hashResult struct {
-	Name string
-	Sum  []byte
-}
-
 func hashMain(opt Options) {
-	nameCh := make(chan string)
-	hashCh := make(chan hashResult)
-
-	var hashWg sync.WaitGroup
-	hashWg.Add(opt.Jobs)
-	go func() {
-		hashWg.Wait()
-		close(hashCh)
-	}()
+	var key *SecretKey
+	if opt.SecretKey != "" {
+		var err error
+		if key, err = LoadSecretKey(opt.SecretKey); err != nil {
+			logError(err)
+			os.Exit(1)
+		}
+	}
+	// Signed output is kept until the end, to be preceded by its signature
+	// unless the signature is detached.
+	var out io.Writer = os.Stdout
+	var signed bytes.Buffer
+	if key != nil && opt.Signature != "" {
+		out = io.MultiWriter(os.Stdout, &signed)
+	} else if key != nil {
+		out = &signed
+	}
+	ctx := signalContext()
+	jobCh := make(chan engine.Job)
+	go walkWorker(ctx, opt, jobCh)
+	eng := newEngine(opt)
+	if opt.Prescan {
+		go prescanFiles(opt, eng.Progress)
+	}
+	progress := startProgress(opt, eng.Progress)
+	stats := newRunStats(opt)
+	resultCh := eng.Run(ctx, jobCh)
 
+	writer := hashsum.Writer{
+		Algorithm: opt.Algo,
+		Tag:       opt.Tag,
+		Zero:      opt.Zero,
+		Binary:    opt.Binary,
+	}
+	recordWriter := RecordWriter{
+		Out:    out,
+		NDJSON: opt.Format == FormatNDJSON,
+	}
 	var errorsCount int64
-	go walkWorker(opt, nameCh, &errorsCount)
-	for range make([]struct{}, opt.Jobs) {
-		go hashWorker(&hashWg, nameCh, hashCh, &errorsCount)
+	firstLinks := make(map[[2]uint64]struct{})
+	reorderer := Reorderer{
+		Sort: opt.Sort,
+		Emit: func(v interface{}) {
+			result := v.(engine.Result)
+			if canceled(ctx, result.Err) {
+				return
+			}
+			if isSkipped(result.Err) {
+				log.Print(result.Err)
+				return
+			}
+			if opt.FirstLink && result.Err == nil && result.Info != nil && engine.LinkCount(result.Info) > 1 {
+				if id, ok := engine.FileIdentity(result.Info); ok {
+					key := [2]uint64{id.Dev, id.Ino}
+					if _, ok := firstLinks[key]; ok {
+						return
+					}
+					firstLinks[key] = struct{}{}
+				}
+			}
+			if result.Err == nil && opt.XattrStore && result.Info != nil && result.Info.Mode().IsRegular() {
+				result.Err = StoreXattrSum(result.Job.Name, opt.Algo, result.Sum, result.Info.ModTime())
+			}
+			if result.Err != nil {
+				stats.AddError(result.Err)
+				errorsCount++
+			} else {
+				stats.Add(result)
+			}
+			if opt.Format != FormatText {
+				_ = recordWriter.Write(newHashRecord(opt, result))
+			} else if result.Err != nil {
+				logError(result.Err)
+			} else {
+				_ = writer.Write(out, result.Sum, result.Name)
+			}
+		},
 	}
-
-	writer := HashSumWriter{
-		Name:   "SHA256",
-		Tag:    opt.Tag,
-		Zero:   opt.Zero,
-		Binary: opt.Binary,
+	for result := range resultCh {
+		result.Name = outputName(opt, result.Name)
+		reorderer.Put(result.Seq, result.Name, result)
 	}
-	if opt.NativePath {
-		for result := range hashCh {
-			writer.Write(os.Stdout, result.Sum, result.Name)
-		}
-	} else {
-		for result := range hashCh {
-			writer.Write(os.Stdout, result.Sum, toUnixPath(result.Name))
-		}
+	reorderer.Flush()
+	progress.Stop()
+	if opt.Format != FormatText {
+		_ = recordWriter.Close()
+	}
+	if key != nil && ctx.Err() == nil && !signOutput(opt, key, signed.Bytes()) {
+		errorsCount++
 	}
 
-	if atomic.LoadInt64(&errorsCount) > 0 {
+	stats.Report()
+	if !finishEngine(opt, eng) || interrupted(ctx) || errorsCount > 0 {
 		os.Exit(1)
 	}
 }
 
-func walkWorker(opt Options, nameCh chan<- string, errorsCount *int64) {
-	defer close(nameCh)
+// signOutput writes the signature of the output to the --signature file, or
+// else to standard output followed by the output.
+func signOutput(opt Options, key *SecretKey, output []byte) (ok bool) {
+	sig := key.Sign(output, publicKeyName(opt.SecretKey))
+	if opt.Signature == "" {
+		_, _ = os.Stdout.Write(sig)
+		_, _ = os.Stdout.Write(output)
+		return true
+	}
+	if err := ioutil.WriteFile(opt.Signature, sig, 0644); err != nil {
+		logError(err)
+		return false
+	}
+	return true
+}
+
+func walkWorker(ctx context.Context, opt Options, jobCh chan<- engine.Job) {
+	defer close(jobCh)
+	send := func(name string, err error) {
+		sendJob(ctx, jobCh, engine.Job{Name: name, Err: err})
+	}
 	if opt.Recursive {
-		statFn := os.Lstat
-		if opt.Dereference {
-			statFn = os.Stat
+		walker := Walker{
+			Dereference:   opt.Dereference,
+			Filter:        opt.Filter,
+			Jobs:          opt.WalkJobs,
+			OneFileSystem: opt.OneFS,
+			MinDepth:      opt.MinDepth,
+			MaxDepth:      opt.MaxDepth,
+			Verbose:       opt.Verbose,
+		}
+		if opt.IgnoreFiles {
+			walker.IgnoreFiles = IgnoreFileNames
 		}
 		for _, path := range opt.Paths {
-			FindRegularFiles(path, statFn, func(name string, err error) {
-				if err == nil {
-					nameCh <- name
-				} else {
-					atomic.AddInt64(errorsCount, 1)
-					logError(err)
-				}
-			})
+			if ctx.Err() != nil {
+				return
+			}
+			walker.FindRegularFiles(path, send)
 		}
 	} else {
 		for _, path := range opt.Paths {
-			nameCh <- path
-		}
-	}
-}
-
-func hashWorker(wg *sync.WaitGroup, nameCh <-chan string, hashCh chan<- hashResult, errorsCount *int64) {
-	defer wg.Done()
-	hash := sha256.New()
-	for name := range nameCh {
-		sum, err := fileHash(hash, name)
-		if err == nil {
-			hashCh <- hashResult{
-				Name: name,
-				Sum:  sum,
+			if !sendJob(ctx, jobCh, engine.Job{Name: path}) {
+				return
 			}
-		} else {
-			atomic.AddInt64(errorsCount, 1)
-			logError(err)
 		}
 	}
 }
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/erinacio/sha256s/engine"
+	"github.com/erinacio/sha256s/hashsum"
+)
+
+// errUnchanged marks jobs of files which are reused from the manifest.
+var errUnchanged = errors.New("unchanged since it was hashed")
+
+// updateCounts counts the files of an update by their outcome.  Kept files
+// are those outside the PATHs, whose entries are copied as they are.
+type updateCounts struct {
+	Added, Updated, Removed, Unchanged, Kept, Errors int64
+}
+
+func updateMain(opt Options) {
+	ctx := signalContext()
+	counts, ok := updateManifest(ctx, opt)
+	if opt.Verbose {
+		log.Printf("%d added, %d updated, %d removed, %d unchanged, %d kept", counts.Added, counts.Updated, counts.Removed, counts.Unchanged, counts.Kept)
+	}
+	if !ok || interrupted(ctx) || counts.Errors > 0 {
+		os.Exit(1)
+	}
+}
+
+// updateManifest rewrites a manifest with checksums of files under the paths,
+// hashing only files missing from it or changed since they were hashed.  The
+// identities of hashed files, their device, inode, size, modification and
+// change time, are kept in a cache file next to the manifest.  Files failing
+// to hash keep their old entries, and so do files outside the paths, unless
+// they no longer exist.  It returns false if the manifest or its cache can't
+// be read or written, if it has checksums of another algorithm, or if it has
+// a detached signature, which would be left stale.
+func updateManifest(ctx context.Context, opt Options) (counts updateCounts, ok bool) {
+	if _, err := os.Stat(opt.Update + ".sig"); err == nil {
+		logError(fmt.Errorf("%s: signed checksum file, its signature %s.sig would be left stale", opt.Update, opt.Update))
+		return counts, false
+	}
+	cachePath := opt.Update + ".cache"
+	cache, err := engine.LoadCache(cachePath)
+	if err != nil {
+		logError(err)
+		return counts, false
+	}
+	var oldEntries []hashsum.Entry
+	old := make(map[string]hashsum.Entry)
+	var oldInfo os.FileInfo
+	var skipInfos []os.FileInfo // the manifest, its cache and the temporary file
+	if info, err := os.Stat(opt.Update); err == nil && info.Size() == 0 {
+		oldInfo = info
+	} else if err == nil {
+		if oldEntries, _, err = readManifest(opt, opt.Update, true); err != nil {
+			logError(err)
+			return counts, false
+		}
+		for _, entry := range oldEntries {
+			if entry.Algorithm.Name != opt.Algo.Name {
+				logError(fmt.Errorf("%s: %d: %s checksum, only %s checksums can be updated, as given by --algo",
+					opt.Update, entry.Line, entry.Algorithm.Name, opt.Algo.Name))
+				return counts, false
+			}
+			old[entry.Name] = entry
+		}
+		oldInfo = info
+	} else if !os.IsNotExist(err) {
+		logError(err)
+		return counts, false
+	}
+	if oldInfo != nil {
+		skipInfos = append(skipInfos, oldInfo)
+	}
+	if info, err := os.Stat(cachePath); err == nil {
+		skipInfos = append(skipInfos, info)
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(opt.Update), filepath.Base(opt.Update)+".*")
+	if err != nil {
+		logError(err)
+		return counts, false
+	}
+	tmpInfo, err := tmp.Stat()
+	if err != nil {
+		logError(err)
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return counts, false
+	}
+	skipInfos = append(skipInfos, tmpInfo)
+
+	walkCh := make(chan engine.Job)
+	jobCh := make(chan engine.Job)
+	go walkWorker(ctx, opt, walkCh)
+	go func() {
+		defer close(jobCh)
+		for job := range walkCh {
+			if job.Err != nil {
+				if !sendJob(ctx, jobCh, job) {
+					return
+				}
+				continue
+			}
+			info, err := os.Stat(job.Name)
+			if err != nil {
+				job.Err = err
+			} else if isChecksumFile(skipInfos, job.Name) {
+				continue
+			} else if entry, ok := old[outputName(opt, job.Name)]; ok && unchangedSince(cache, opt.Algo.Name, info, entry.Sum) {
+				job.Err, job.Data = errUnchanged, entry.Sum
+			}
+			if !sendJob(ctx, jobCh, job) {
+				return
+			}
+		}
+	}()
+	eng := newEngine(opt)
+	resultCh := eng.Run(ctx, jobCh)
+
+	out := bufio.NewWriter(tmp)
+	writer := hashsum.Writer{
+		Algorithm: opt.Algo,
+		Tag:       opt.Tag,
+		Zero:      opt.Zero,
+		Binary:    opt.Binary,
+	}
+	seen := make(map[string]struct{}, len(old))
+	var unreadable []string // paths of failures, whose files may still exist
+	reorderer := Reorderer{
+		Sort: opt.Sort,
+		Emit: func(v interface{}) {
+			result := v.(engine.Result)
+			switch {
+			case canceled(ctx, result.Err):
+				return
+			case isSkipped(result.Err):
+				log.Print(result.Err)
+				return
+			case result.Err == errUnchanged:
+				result.Sum = result.Data.([]byte)
+				counts.Unchanged++
+			case result.Err != nil:
+				logError(result.Err)
+				counts.Errors++
+				unreadable = append(unreadable, result.Job.Name)
+				entry, ok := old[result.Name]
+				if !ok {
+					return
+				}
+				result.Sum = entry.Sum
+			default:
+				if entry, ok := old[result.Name]; !ok {
+					counts.Added++
+				} else if bytes.Equal(entry.Sum, result.Sum) {
+					counts.Unchanged++
+				} else {
+					counts.Updated++
+				}
+				if result.Info != nil {
+					id, ok := engine.FileIdentity(result.Info)
+					if path, err := filepath.Abs(result.Job.Name); ok && err == nil {
+						cache.Store(opt.Algo.Name, id, path, result.Sum)
+					}
+				}
+			}
+			seen[result.Name] = struct{}{}
+			_ = writer.Write(out, result.Sum, result.Name)
+		},
+	}
+	for result := range resultCh {
+		result.Name = outputName(opt, result.Name)
+		reorderer.Put(result.Seq, result.Name, result)
+	}
+	reorderer.Flush()
+
+	if ctx.Err() != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return counts, finishEngine(opt, eng)
+	}
+	for _, entry := range oldEntries {
+		if _, ok := seen[entry.Name]; ok {
+			continue
+		}
+		seen[entry.Name] = struct{}{}
+		name := entry.Name
+		if !opt.NativePath {
+			name = fromUnixPath(name)
+		}
+		if _, err := os.Stat(name); os.IsNotExist(err) || (walkedPath(opt, opt.Paths, name) && !walkedPath(opt, unreadable, name)) {
+			counts.Removed++
+			continue
+		}
+		counts.Kept++
+		_ = writer.Write(out, entry.Sum, entry.Name)
+	}
+	saved := true
+	if err = saveManifest(tmp, out, opt.Update, oldInfo); err != nil {
+		logError(err)
+		saved = false
+	} else if err = cache.Save(cachePath); err != nil {
+		logError(err)
+		saved = false
+	}
+	return counts, finishEngine(opt, eng) && saved
+}
+
+// unchangedSince reports whether a file has the same identity as when it was
+// hashed to sum, according to the cache.  Restoring an old modification
+// time, like cp -p and tar do, still updates the change time.  On systems
+// without file identities, files are never considered unchanged.
+func unchangedSince(cache *engine.Cache, algo string, info os.FileInfo, sum []byte) bool {
+	id, ok := engine.FileIdentity(info)
+	if !ok {
+		return false
+	}
+	cached, ok := cache.Lookup(algo, id)
+	return ok && bytes.Equal(cached, sum)
+}
+
+// walkedPath reports whether a file is one of the paths, or below one of them
+// with --recursive.
+func walkedPath(opt Options, paths []string, name string) bool {
+	abs, err := filepath.Abs(name)
+	if err != nil {
+		return false
+	}
+	for _, path := range paths {
+		root, err := filepath.Abs(path)
+		if err != nil {
+			continue
+		}
+		rel, err := filepath.Rel(root, abs)
+		if err == nil && (rel == "." || (opt.Recursive && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))) {
+			return true
+		}
+	}
+	return false
+}
+
+// saveManifest renames the written temporary file over the manifest, keeping
+// the permissions of the old one if oldInfo isn't nil.
+func saveManifest(tmp *os.File, out *bufio.Writer, path string, oldInfo os.FileInfo) (err error) {
+	defer func() {
+		if err != nil {
+			_ = tmp.Close()
+			_ = os.Remove(tmp.Name())
+		}
+	}()
+	if err = out.Flush(); err != nil {
+		return
+	}
+	mode := os.FileMode(0644)
+	if oldInfo != nil {
+		mode = oldInfo.Mode().Perm()
+	}
+	if err = tmp.Chmod(mode); err != nil {
+		return
+	}
+	if err = tmp.Close(); err != nil {
+		return
+	}
+	return os.Rename(tmp.Name(), path)
+}
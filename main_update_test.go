@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/erinacio/sha256s/hashsum"
+)
+
+func TestUpdateManifest(t *testing.T) {
+	dir := t.TempDir()
+	manifest := filepath.Join(dir, "SUMS")
+	files := filepath.Join(dir, "files")
+	write := func(name, content string) {
+		if err := os.MkdirAll(files, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(files, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	update := func(want updateCounts) {
+		t.Helper()
+		var opt Options
+		if err := opt.Parse([]string{"--update=" + manifest, "-r", files}); err != nil {
+			t.Fatal(err)
+		}
+		counts, ok := updateManifest(context.Background(), opt)
+		if !ok || counts != want {
+			t.Errorf("update = %+v, %v, want %+v, true", counts, ok, want)
+		}
+		// changes within the granularity of file times aren't detected
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	write("a", "hello")
+	write("b", "world")
+	write("c", "gone")
+	update(updateCounts{Added: 3})
+	update(updateCounts{Unchanged: 3})
+
+	// a is modified and its old modification time restored, like cp -p and
+	// tar do, b is touched, c is deleted and d is new, and the manifest is
+	// touched into the future, which mustn't hide any of these
+	future := time.Now().Add(time.Hour)
+	if err := os.Chtimes(manifest, future, future); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(filepath.Join(files, "a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	write("a", "hello, world")
+	if err = os.Chtimes(filepath.Join(files, "a"), info.ModTime(), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	if err = os.Chtimes(filepath.Join(files, "b"), now, now); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Remove(filepath.Join(files, "c")); err != nil {
+		t.Fatal(err)
+	}
+	write("d", "new")
+	update(updateCounts{Added: 1, Updated: 1, Removed: 1, Unchanged: 1})
+
+	var opt Options
+	if err = opt.Parse([]string{manifest}); err != nil {
+		t.Fatal(err)
+	}
+	entries, badLines, err := readManifest(opt, manifest, false)
+	if err != nil || badLines != 0 {
+		t.Fatalf("readManifest = %d bad lines, %v", badLines, err)
+	}
+	want := map[string]string{"a": "hello, world", "b": "world", "d": "new"}
+	if len(entries) != len(want) {
+		t.Errorf("manifest has %d entries, want %d", len(entries), len(want))
+	}
+	for _, entry := range entries {
+		content, ok := want[filepath.Base(entry.Name)]
+		if sum := sha256.Sum256([]byte(content)); !ok || string(entry.Sum) != string(sum[:]) {
+			t.Errorf("manifest entry of %s is stale or unexpected", entry.Name)
+		}
+	}
+}
+
+// runUpdate runs --update with the arguments.
+func runUpdate(t *testing.T, args ...string) (updateCounts, bool) {
+	t.Helper()
+	var opt Options
+	if err := opt.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	return updateManifest(context.Background(), opt)
+}
+
+func TestUpdateManifestKeepsOtherEntries(t *testing.T) {
+	dir := t.TempDir()
+	manifest := filepath.Join(dir, "SUMS")
+	for _, name := range []string{"a", "b", "c"} {
+		writeTestFile(t, filepath.Join(dir, name), name)
+	}
+	// the manifest and its cache are in the walked directory, but not listed
+	if counts, ok := runUpdate(t, "--update="+manifest, "-r", dir); !ok || counts != (updateCounts{Added: 3}) {
+		t.Fatalf("update = %+v, %v, want 3 added", counts, ok)
+	}
+
+	// c is outside the walked PATH, and b is gone
+	if err := os.Remove(filepath.Join(dir, "b")); err != nil {
+		t.Fatal(err)
+	}
+	want := updateCounts{Unchanged: 1, Removed: 1, Kept: 1}
+	if counts, ok := runUpdate(t, "--update="+manifest, filepath.Join(dir, "a")); !ok || counts != want {
+		t.Errorf("update of a = %+v, %v, want %+v", counts, ok, want)
+	}
+	entries, _, err := readManifest(Options{Algo: hashsum.DefaultAlgorithm}, manifest, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, filepath.Base(entry.Name))
+	}
+	if fmt.Sprint(names) != "[a c]" {
+		t.Errorf("manifest lists %v, want [a c]", names)
+	}
+
+	// a file of the walked directory which isn't found by the walk is removed
+	want = updateCounts{Unchanged: 1, Removed: 1}
+	if counts, ok := runUpdate(t, "--update="+manifest, "-r", "--exclude=c", dir); !ok || counts != want {
+		t.Errorf("update excluding c = %+v, %v, want %+v", counts, ok, want)
+	}
+}
+
+func TestUpdateManifestOtherAlgorithm(t *testing.T) {
+	dir := t.TempDir()
+	manifest := filepath.Join(dir, "SUMS")
+	writeTestFile(t, filepath.Join(dir, "a"), "a")
+	content := "SHA512 (a) = " + fmt.Sprintf("%0128x", 0) + "\n"
+	writeTestFile(t, manifest, content)
+	if _, ok := runUpdate(t, "--update="+manifest, filepath.Join(dir, "a")); ok {
+		t.Error("update of a manifest of SHA512 checksums succeeded")
+	}
+	if got, err := os.ReadFile(manifest); err != nil || string(got) != content {
+		t.Errorf("manifest changed to %q, %v", got, err)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/erinacio/sha256s/engine"
+)
+
+type storedSum struct {
+	Sum []byte
+	Ts  string
+}
+
+func xattrVerifyMain(opt Options) {
+	ctx := signalContext()
+	walkCh := make(chan engine.Job)
+	jobCh := make(chan engine.Job)
+	go walkWorker(ctx, opt, walkCh)
+	go func() {
+		defer close(jobCh)
+		for job := range walkCh {
+			if job.Err == nil {
+				var stored storedSum
+				stored.Sum, stored.Ts, job.Err = LoadXattrSum(job.Name, opt.Algo)
+				job.Data = stored
+			}
+			if !sendJob(ctx, jobCh, job) {
+				return
+			}
+		}
+	}()
+	eng := newEngine(opt)
+	resultCh := eng.Run(ctx, jobCh)
+
+	var noSumCount, outdatedCount, errorsCount, mismatchCount int64
+	reorderer := Reorderer{
+		Sort: opt.Sort,
+		Emit: func(v interface{}) {
+			result := v.(engine.Result)
+			var stat string
+			switch {
+			case canceled(ctx, result.Err):
+				return
+			case isSkipped(result.Err):
+				log.Print(result.Err)
+				return
+			case result.Err == errNoStoredChecksum:
+				noSumCount++
+				return
+			case result.Err != nil:
+				errorsCount++
+				logError(result.Err)
+				return
+			case result.Info == nil || !xattrTimestampMatches(result.Data.(storedSum).Ts, result.Info.ModTime()):
+				outdatedCount++
+				stat = "OUTDATED"
+			case bytes.Equal(result.Sum, result.Data.(storedSum).Sum):
+				stat = "OK"
+			default:
+				mismatchCount++
+				stat = "FAILED"
+			}
+			name := escapeStatusName(result.Name)
+			if stat != "OK" || !opt.Quiet {
+				fmt.Printf("%s: %s\n", name, stat)
+			}
+		},
+	}
+	for result := range resultCh {
+		result.Name = outputName(opt, result.Name)
+		reorderer.Put(result.Seq, result.Name, result)
+	}
+	reorderer.Flush()
+
+	if c := noSumCount; c > 0 {
+		log.Printf("WARNING: %d %s no stored checksum", c, iif(c == 1, "file has", "files have"))
+	}
+	if c := outdatedCount; c > 0 {
+		log.Printf("WARNING: %d stored %s outdated", c, iif(c == 1, "checksum is", "checksums are"))
+	}
+	if c := mismatchCount; c > 0 {
+		log.Printf("WARNING: %d computed %s did not match", c, iif(c == 1, "checksum", "checksums"))
+	}
+	if !finishEngine(opt, eng) || interrupted(ctx) || errorsCount != 0 || mismatchCount != 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+
+	"github.com/erinacio/sha256s/hashsum"
+)
+
+// readManifest reads all properly formatted lines of a checksum file.
+// Rejected lines are counted and reported if warn is set.  Checksum files with
+// an embedded signature are rejected, unless they're verified by --check
+// --public-key, so that unverified lines are never trusted.
+func readManifest(opt Options, path string, warn bool) (entries []hashsum.Entry, badLines int64, err error) {
+	file, err := OpenFile(path)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	rd := bufio.NewReader(file)
+	if head, _ := rd.Peek(len(commentPrefix)); string(head) == commentPrefix {
+		if opt.PublicKey == "" {
+			err = fmt.Errorf("%s: signed checksum file, verify it with --check --public-key", path)
+			return
+		}
+		_, _ = rd.ReadBytes('\n')
+		_, _ = rd.ReadBytes('\n')
+	}
+	reader := hashsum.NewReader(rd, path)
+	reader.Default = opt.Algo
+	reader.Zero = opt.Zero
+	reader.CrLf = opt.CrLf
+	err = reader.ForEach(func(entry hashsum.Entry, err error) {
+		if err != nil {
+			if warn {
+				logError(err)
+			}
+			badLines++
+			return
+		}
+		entries = append(entries, entry)
+	})
+	if err == nil && len(entries) == 0 {
+		err = fmt.Errorf("%s: no properly formatted checksum lines found", path)
+	}
+	return
+}
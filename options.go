@@ -2,89 +2,304 @@ package main
 
 import (
 	"errors"
+	"fmt"
 	"io"
+	"math"
 	"runtime"
 	"strconv"
+	"strings"
 
+	"github.com/erinacio/sha256s/engine"
+	"github.com/erinacio/sha256s/hashsum"
 	"github.com/spf13/pflag"
 )
 
 type Options struct {
+	Algo        hashsum.Algorithm
 	Binary      bool
+	BufferSize  SizeValue
+	BwLimit     SizeValue
+	BwLimitFile SizeValue
+	Cache       string
 	Check       bool
+	Dedupe      string
+	Diff        bool
+	Format      string
+	IgnoreFiles bool
+	IO          engine.IOStrategy
 	Jobs        int
+	Keygen      bool
 	Dereference bool
+	Filter      *Filter
+	FindDups    bool
+	FirstLink   bool
+	HardLinks   bool
+	MaxDepth    int
+	MinDepth    int
 	NativePath  bool
+	OneFS       bool
+	Prescan     bool
+	Progress    bool
+	ProgressFD  int
+	PublicKey   string
+	Rehash      bool
 	Recursive   bool
+	SecretKey   string
+	Signature   string
+	Sort        bool
+	Stats       int
 	Tag         bool
+	Update      string
+	Verbose     bool
+	WalkJobs    int
+	XattrStore  bool
+	XattrVerify bool
 	Zero        bool
 
 	CrLf          bool
+	FailUntracked bool
 	IgnoreMissing bool
 	Quiet         bool
+	Report        string
 	Status        bool
 	Strict        bool
+	Untracked     string
 	Warn          bool
 
 	Paths []string
 }
 
 func (o *Options) Parse(args []string) (err error) {
-	*o = Options{}
+	*o = Options{Algo: hashsum.DefaultAlgorithm, BufferSize: 32 << 10}
 	fs := pflag.NewFlagSet("sha256s", pflag.ContinueOnError)
+	fs.VarP((*AlgorithmValue)(&o.Algo), "algo", "a", "")
 	fs.BoolVarP(&o.Binary, "binary", "b", false, "")
+	fs.Var(&o.BufferSize, "buffer-size", "")
+	fs.Var(&o.BwLimit, "bwlimit", "")
+	fs.Var(&o.BwLimitFile, "bwlimit-file", "")
+	fs.StringVar(&o.Cache, "cache", "", "")
 	fs.BoolVarP(&o.Check, "check", "c", false, "")
+	fs.StringVar(&o.Dedupe, "dedupe", "", "")
+	fs.BoolVar(&o.Diff, "diff", false, "")
+	filter := &Filter{}
+	fs.Var(&PatternListValue{List: &filter.Excludes}, "exclude", "")
+	fs.Var(&PatternListValue{List: &filter.Excludes, FromFile: true}, "exclude-from", "")
+	fs.BoolVar(&o.FindDups, "find-duplicates", false, "")
+	fs.BoolVar(&o.FirstLink, "first-link", false, "")
+	fs.StringVar(&o.Format, "format", FormatText, "")
+	fs.BoolVar(&o.HardLinks, "hardlinks", false, "")
+	fs.BoolVar(&o.IgnoreFiles, "ignore-files", false, "")
+	fs.Var(&PatternListValue{List: &filter.Includes}, "include", "")
+	fs.StringVar((*string)(&o.IO), "io", string(engine.IORead), "")
 	fs.IntVarP(&o.Jobs, "jobs", "j", 1, "")
+	fs.BoolVar(&o.Keygen, "keygen", false, "")
 	fs.BoolVarP(&o.Dereference, "dereference", "L", false, "")
+	fs.IntVar(&o.MaxDepth, "max-depth", -1, "")
+	fs.IntVar(&o.MinDepth, "min-depth", 0, "")
 	fs.BoolVar(&o.NativePath, "native-path", false, "")
 	fs.VarPF((*NegateBoolValue)(&o.Dereference), "no-dereference", "P", "").NoOptDefVal = "true"
+	fs.BoolVar(&o.OneFS, "one-file-system", false, "")
+	fs.BoolVar(&o.Prescan, "prescan", false, "")
+	fs.BoolVar(&o.Progress, "progress", false, "")
+	fs.IntVar(&o.ProgressFD, "progress-fd", -1, "")
+	fs.StringVar(&o.PublicKey, "public-key", "", "")
+	fs.BoolVar(&o.Rehash, "rehash", false, "")
 	fs.BoolVarP(&o.Recursive, "recursive", "r", false, "")
+	fs.StringVar(&o.SecretKey, "secret-key", "", "")
+	fs.StringVar(&o.Signature, "signature", "", "")
+	fs.BoolVar(&o.Sort, "sort", false, "")
+	fs.IntVar(&o.Stats, "stats", 0, "")
 	fs.BoolVar(&o.Tag, "tag", false, "")
 	fs.VarPF((*NegateBoolValue)(&o.Binary), "text", "t", "").NoOptDefVal = "true"
+	fs.StringVar(&o.Update, "update", "", "")
+	fs.BoolVar(&o.XattrStore, "xattr-store", false, "")
+	fs.BoolVar(&o.XattrVerify, "xattr-verify", false, "")
+	fs.BoolVar(&o.Verbose, "verbose", false, "")
+	fs.IntVar(&o.WalkJobs, "walk-jobs", 1, "")
 	fs.BoolVarP(&o.Zero, "zero", "z", false, "")
 	fs.BoolVar(&o.CrLf, "crlf", false, "")
+	fs.BoolVar(&o.FailUntracked, "fail-untracked", false, "")
 	fs.BoolVar(&o.IgnoreMissing, "ignore-missing", false, "")
 	fs.BoolVarP(&o.Quiet, "quiet", "q", false, "")
+	fs.StringVar(&o.Report, "report", ReportText, "")
 	fs.BoolVar(&o.Status, "status", false, "")
 	fs.BoolVar(&o.Strict, "strict", false, "")
+	fs.StringVar(&o.Untracked, "untracked", "", "")
 	fs.BoolVarP(&o.Warn, "warn", "w", false, "")
 	fs.VarPF(HelpRequestedError{}, "help", "h", "").NoOptDefVal = "x"
 	fs.VarPF(VersionRequestedError{}, "version", "v", "").NoOptDefVal = "x"
 	fs.Lookup("jobs").NoOptDefVal = strconv.Itoa(runtime.NumCPU())
+	fs.Lookup("stats").NoOptDefVal = "10"
+	fs.Lookup("walk-jobs").NoOptDefVal = strconv.Itoa(runtime.NumCPU())
 	if err = fs.Parse(args); err != nil {
 		return err
 	}
 	o.Paths = fs.Args()
+	if len(filter.Excludes) > 0 || len(filter.Includes) > 0 {
+		o.Filter = filter
+	}
 
-	if o.CrLf && !o.Check {
+	if o.Keygen && (o.PublicKey == "" || o.SecretKey == "") {
+		return errors.New("the --keygen option requires --public-key and --secret-key")
+	}
+	if o.Keygen && (len(o.Paths) > 0 || o.Check || o.Diff || o.FindDups || o.Update != "" || o.XattrVerify || o.Signature != "") {
+		return errors.New("the --keygen option only generates keys, without PATHs")
+	}
+	if o.SecretKey != "" && !o.Keygen && (o.Check || o.Diff || o.FindDups || o.Update != "" || o.XattrVerify) {
+		return errors.New("the --secret-key option is meaningful only when printing checksums")
+	}
+	if o.PublicKey != "" && !o.Keygen && !o.Check {
+		return errors.New("the --public-key option is meaningful only when verifying checksums")
+	}
+	if o.Signature != "" && o.SecretKey == "" && o.PublicKey == "" {
+		return errors.New("the --signature option is meaningful only with --secret-key or --public-key")
+	}
+	if o.Signature != "" && o.Check && len(o.Paths) > 1 {
+		return errors.New("the --signature option requires a single checksum file")
+	}
+	if o.Diff && (o.Check || o.FindDups || o.XattrVerify) {
+		return errors.New("the --check, --diff, --find-duplicates and --xattr-verify options are mutually exclusive")
+	}
+	if o.Diff && (o.Recursive || o.Tag || o.Binary || o.FirstLink || o.XattrStore) {
+		return errors.New("the --diff option only compares checksum files, without hashing files")
+	}
+	if o.Diff && len(o.Paths) != 2 {
+		return errors.New("the --diff option requires exactly two checksum files")
+	}
+	if o.Update != "" && (o.Check || o.Diff || o.FindDups || o.XattrVerify) {
+		return errors.New("the --update option can't be combined with --check, --diff, --find-duplicates or --xattr-verify")
+	}
+	if o.Update != "" && o.Format != FormatText {
+		return errors.New("the --update option writes only text checksum files")
+	}
+	if o.Update == "-" {
+		return errors.New("the --update option requires a file, not standard input")
+	}
+	if o.CrLf && !o.Check && !o.Diff {
 		return errors.New("the --crlf option is meaningful only when verifying checksums")
 	}
+	if o.Untracked != "" && !o.Check {
+		return errors.New("the --untracked option is meaningful only when verifying checksums")
+	}
+	if o.FailUntracked && o.Untracked == "" {
+		return errors.New("the --fail-untracked option is meaningful only with --untracked")
+	}
 	if o.IgnoreMissing && !o.Check {
 		return errors.New("the --ignore-missing option is meaningful only when verifying checksums")
 	}
-	if o.Quiet && !o.Check {
+	if o.Quiet && !o.Check && !o.XattrVerify {
 		return errors.New("the --quiet option is meaningful only when verifying checksums")
 	}
+	if o.Report != ReportText && o.Report != ReportJSON {
+		return fmt.Errorf("invalid argument %q for --report, expected text or json", o.Report)
+	}
+	if o.Report != ReportText && !o.Check {
+		return errors.New("the --report option is meaningful only when verifying checksums")
+	}
 	if o.Status && !o.Check {
 		return errors.New("the --status option is meaningful only when verifying checksums")
 	}
-	if o.Strict && !o.Check {
+	if o.Status && o.Report != ReportText {
+		return errors.New("the --status option doesn't output anything, including the --report document")
+	}
+	if o.Status && o.Progress {
+		return errors.New("the --status option doesn't output anything, including the --progress line")
+	}
+	if o.Strict && !o.Check && !o.Diff {
 		return errors.New("the --strict option is meaningful only when verifying checksums")
 	}
-	if o.Warn && !o.Check {
+	if o.Warn && !o.Check && !o.Diff {
 		return errors.New("the --warn option is meaningful only when verifying checksums")
 	}
+	if o.Tag && o.Check {
+		return errors.New("the --tag option is meaningless when verifying checksums, formats are detected line by line")
+	}
 	if o.Recursive && o.Check {
 		return errors.New("the --recursive option is meaningless when verifying checksums")
 	}
+	if o.Format != FormatText && o.Format != FormatJSON && o.Format != FormatNDJSON {
+		return fmt.Errorf("invalid argument %q for --format, expected text, json or ndjson", o.Format)
+	}
+	if o.Format != FormatText && o.Check {
+		return errors.New("the --format option is meaningless when verifying checksums")
+	}
+	if o.Format != FormatText && (o.Tag || o.Zero) {
+		return errors.New("the --tag and --zero options are meaningful only with --format=text")
+	}
+	if (o.XattrStore || o.XattrVerify) && o.Check {
+		return errors.New("the --xattr-store and --xattr-verify options are meaningless when verifying checksums")
+	}
+	if o.XattrStore && o.XattrVerify {
+		return errors.New("the --xattr-store and --xattr-verify options are mutually exclusive")
+	}
+	if o.XattrVerify && (o.Format != FormatText || o.Tag || o.Zero || o.Binary) {
+		return errors.New("the --xattr-verify option doesn't print checksums")
+	}
+	if o.FirstLink && (o.Check || o.XattrVerify) {
+		return errors.New("the --first-link option is meaningful only when printing checksums")
+	}
+	if o.FindDups && (o.Check || o.XattrStore || o.XattrVerify || o.FirstLink) {
+		return errors.New("the --find-duplicates option can't be combined with --check, --first-link, --xattr-store or --xattr-verify")
+	}
+	if o.FindDups && o.Zero {
+		return errors.New("the --zero option is meaningless with --find-duplicates")
+	}
+	if o.Dedupe != "" && o.Dedupe != DedupeHardlink && o.Dedupe != DedupeReflink {
+		return fmt.Errorf("invalid argument %q for --dedupe, expected hardlink or reflink", o.Dedupe)
+	}
+	if o.Dedupe != "" && !o.FindDups {
+		return errors.New("the --dedupe option is meaningful only with --find-duplicates")
+	}
+	if (o.Progress || o.ProgressFD >= 0) && (o.Diff || o.FindDups || o.Update != "" || o.XattrVerify) {
+		return errors.New("the --progress and --progress-fd options are meaningful only when printing or verifying checksums")
+	}
+	if o.ProgressFD < -1 {
+		return errors.New("the --progress-fd option requires a file descriptor number")
+	}
+	if o.Prescan && !o.Progress && o.ProgressFD < 0 {
+		return errors.New("the --prescan option is meaningful only with --progress or --progress-fd")
+	}
+	if (o.BwLimit != 0 || o.BwLimitFile != 0) && o.Diff {
+		return errors.New("the --bwlimit and --bwlimit-file options are meaningless with --diff")
+	}
+	if o.Stats != 0 && (o.Diff || o.FindDups || o.Update != "" || o.XattrVerify) {
+		return errors.New("the --stats option is meaningful only when printing or verifying checksums")
+	}
+	if o.Stats < 0 {
+		return errors.New("the --stats option requires a non-negative integer argument")
+	}
+	if o.Rehash && o.Cache == "" {
+		return errors.New("the --rehash option is meaningful only with --cache")
+	}
+	if (o.Filter != nil || o.IgnoreFiles) && !o.Recursive {
+		return errors.New("the --exclude, --exclude-from, --ignore-files and --include options are meaningful only with --recursive")
+	}
 	if o.Dereference && !o.Recursive {
 		return errors.New("the --dereference option is meaningful only with --recursive")
 	}
+	if (o.OneFS || o.MaxDepth >= 0 || o.MinDepth != 0) && !o.Recursive {
+		return errors.New("the --max-depth, --min-depth and --one-file-system options are meaningful only with --recursive")
+	}
+	if o.WalkJobs != 1 && !o.Recursive {
+		return errors.New("the --walk-jobs option is meaningful only with --recursive")
+	}
+	if o.MinDepth < 0 {
+		return errors.New("the --min-depth option requires a non-negative integer argument")
+	}
 
+	if o.IO != engine.IORead && o.IO != engine.IOMmap {
+		return fmt.Errorf("invalid argument %q for --io, expected read or mmap", o.IO)
+	}
+	if o.BufferSize <= 0 || o.BufferSize > 1<<30 {
+		return errors.New("the --buffer-size option requires a size between 1 byte and 1 GiB")
+	}
 	if o.Jobs <= 0 {
 		return errors.New("the --jobs option requires a positive integer argument")
 	}
-	if len(o.Paths) == 0 {
+	if o.WalkJobs <= 0 {
+		return errors.New("the --walk-jobs option requires a positive integer argument")
+	}
+	if len(o.Paths) == 0 && !o.Keygen {
 		o.Paths = []string{"-"}
 	}
 
@@ -101,31 +316,123 @@ func (*Options) PrintHelp(out io.Writer) {
 
 const Help = `
 Usage: sha256s [OPTION]... [PATH]...
-Print or check SHA256 (256-bit) checksums, using SIMD instructions for
-acceleration if possible.
+  or:  sha256s --diff [OPTION]... OLD NEW
+  or:  sha256s --keygen --public-key=FILE --secret-key=FILE
+Print or check SHA256 (256-bit) checksums, or checksums of another algorithm
+given by --algo, using SIMD instructions for acceleration if possible.
 
 With no PATH, or when PATH is -, read standard input.
 
+  -a, --algo=NAME       use hash algorithm NAME, one of SHA1, SHA224,
+                          SHA256 (default), SHA384, SHA512, SHA512t256,
+                          BLAKE2b, BLAKE2s
   -b, --binary          read in binary mode
-  -c, --check           read SHA256 sums from the PATHs and check them
+      --buffer-size=SIZE
+                        read files with buffers of SIZE bytes, or hash mapped
+                          files in chunks of SIZE, K, M and G suffixes are
+                          allowed (default 32K)
+      --bwlimit=RATE    read files at most RATE bytes per second in total,
+                          with the same suffixes as --buffer-size, halved by
+                          SIGUSR1 and doubled by SIGUSR2 while running,
+                          files aren't mapped when limited
+      --bwlimit-file=RATE
+                        read each file at most RATE bytes per second, also
+                          halved by SIGUSR1 and doubled by SIGUSR2
+      --cache=FILE      reuse checksums of files whose device, inode, size,
+                          modification and change time are unchanged since
+                          they were stored in FILE, and update FILE
+  -c, --check           read checksums from the PATHs and check them
+      --dedupe=METHOD   replace duplicates found by --find-duplicates with a
+                          hardlink or reflink to the first file of their
+                          group, after comparing them byte for byte
+      --diff            compare two checksum files, OLD and NEW, and print
+                          added, removed, modified and renamed files, which
+                          have a digest of a removed file, exit status is 0
+                          if they are the same, 1 if different, 2 if trouble
+      --exclude=PATTERN skip files and directories matching PATTERN when
+                          traversing directories
+      --exclude-from=FILE
+                        read exclude patterns from FILE, one per line
+      --find-duplicates print groups of files with the same content, their
+                          size and wasted space, instead of checksums
+      --first-link      print only the first of several hard links to the
+                          same file, implies --hardlinks
+      --format=FORMAT   print checksums as text (default), a JSON array of
+                          records, or ndjson for a JSON record per line
+      --hardlinks       hash files with several hard links once, and reuse
+                          the checksum for the other links
+      --ignore-files    skip files ignored by .gitignore, .ignore and
+                          .sha256signore files, and .git directories, when
+                          traversing directories
+      --include=PATTERN only hash files matching PATTERN when traversing
+                          directories, unless excluded
+      --io=METHOD       read files with read(2) (default), or mmap files
+                          larger than the buffer size
   -j [N], --jobs[=N]    allow N jobs at once, cpu number with no arg
+      --keygen          generate an Ed25519 key pair in signify format, with
+                          an unencrypted secret key
   -L, --dereference     always follow symbolic links in PATHs
+      --max-depth=N     descend at most N directory levels below PATHs
+      --min-depth=N     don't hash files less than N levels below PATHs
       --native-path     use backslash as path separator on Windows
   -P, --no-dereference  never follow symbolic links in PATHs (default)
+      --one-file-system don't descend into directories on other file systems
+                          than PATHs, skipped ones are reported with --verbose
+      --prescan         find the number and total size of files first, to
+                          show the ETA with --progress and --progress-fd
+      --progress        show files and bytes done, throughput, the largest
+                          file being hashed and the ETA on standard error,
+                          only the final line unless it's a terminal
+      --progress-fd=N   write progress as a JSON object per line to file
+                          descriptor N
+      --public-key=FILE verify checksum files with the signify or minisign
+                          public key FILE before reading any line of them
+      --rehash          hash all files again, even if cached
   -r, --recursive       traverse directories in PATHs
-      --tag             create or read a BSD-style checksum
+      --secret-key=FILE sign the output with the signify secret key FILE,
+                          printing the signature before it
+      --signature=FILE  write the signature to FILE instead, or verify
+                          against the detached signature FILE
+      --sort            output results sorted by file name instead of in
+                          argument and traversal order
+      --stats[=N]       print files and bytes done, throughput of the run and
+                          of each job, the N slowest files, 10 with no arg,
+                          and errors by category at exit
+      --tag             create a BSD-style checksum
   -t, --text            read in text mode (default)
+      --update=MANIFEST rewrite MANIFEST with checksums of files in PATHs,
+                          hashing only files missing from it or changed
+                          since they were hashed, as recorded in
+                          MANIFEST.cache, removing only files deleted or not
+                          found in PATHs
+      --verbose         report the throughput of each read method at exit,
+                          and skipped mount points
+      --walk-jobs[=N]   read N directories at once when traversing, cpu
+                          number with no arg
+      --xattr-store     also store checksums in the user.shatag.ALGO extended
+                          attribute of files, along with their modification
+                          time in user.shatag.ts
+      --xattr-verify    check files against checksums in extended attributes
+                          instead of printing checksums, files modified
+                          since are reported as OUTDATED
   -z, --zero            end each output line with NUL, not newline,
                         and disable file name escaping
 
-The following six options are useful only when verifying checksums:
+The following nine options are useful only when verifying checksums, and
+--quiet is also useful with --xattr-verify, and --crlf, --strict and --warn
+with --diff:
       --crlf            allow checksum lines ending with CRLF, always true on
                           Windows system because Windows file names can't
                           contain "\r"
+      --fail-untracked  fail if --untracked finds files
       --ignore-missing  don't fail or report status for missing files
   -q, --quiet           don't print OK for each successfully verified file
+      --report=FORMAT   print results as text (default), or as a JSON
+                          document with every entry and the final counters
       --status          don't output anything, status code shows success
       --strict          exit non-zero for improperly formatted checksum lines
+      --untracked=ROOT  report regular files under ROOT which aren't listed
+                          in any checksum file as UNTRACKED
   -w, --warn            warn about improperly formatted checksum lines
 
   -h, --help     display this help and exit
@@ -136,6 +443,31 @@ Note: There is no difference between binary mode and text mode in this
       '*' before file names in binary mode.  Command-line symbolic links in
       PATHs are always dereferenced, regardless of --no-dereference, so
       --dereference option is meaningful only with --recursive.
+      Patterns of --exclude, --exclude-from and --include follow gitignore
+      rules and are matched against paths relative to each PATH, with the
+      last matching pattern winning, and a leading '!' negating a pattern.
+      Ignore files apply to their own directory and below, with deeper ones
+      taking precedence, and .sha256signore over .ignore over .gitignore.
+      Depths count from 0 for PATHs themselves, so --max-depth=1 hashes only
+      files directly in PATHs, and --max-depth=0 hashes only PATHs which are
+      files.
+      Cached checksums are trusted as-is, so --cache doesn't detect silent
+      data corruption when verifying checksums.
+      Signed output can also be verified by signify -V -e, or -V -m with a
+      detached signature, and by signify -C if printed with --tag.  When
+      checking, a checksum file is verified with its embedded signature if
+      any, or else with --signature, PATH.sig by default.  Signed checksum
+      files are rejected by --diff and --update, which can't verify them or
+      sign them again.
+      Files are considered changed by --update if their device, inode, size,
+      modification or change time differs, and always on systems without
+      change times.  Files failing to hash keep their old checksums.
+
+When checking, GNU and BSD-style lines are detected line by line.  The
+algorithm of a BSD-style line is given by its tag, and that of a GNU-style
+line is inferred from the digest length, preferring the algorithm given by
+--algo.  Lines whose digest length matches several other algorithms are
+rejected as improperly formatted.
 `
 
 type HelpRequestedError struct{}
@@ -166,3 +498,61 @@ func (b *NegateBoolValue) Set(s string) error {
 	*b = NegateBoolValue(!v)
 	return err
 }
+
+type AlgorithmValue hashsum.Algorithm
+
+func (a AlgorithmValue) String() string { return a.Name }
+func (a AlgorithmValue) Type() string   { return "name" }
+func (a *AlgorithmValue) Set(s string) error {
+	algo, ok := hashsum.LookupAlgorithm(s)
+	if !ok {
+		return fmt.Errorf("unknown algorithm %q, expected one of %s", s, strings.Join(hashsum.AlgorithmNames(), ", "))
+	}
+	*a = AlgorithmValue(algo)
+	return nil
+}
+
+// SizeValue is a byte size with an optional binary suffix of K, M, G or T,
+// which may be followed by "iB" or "B".
+type SizeValue int64
+
+func (v SizeValue) String() string { return strconv.FormatInt(int64(v), 10) }
+func (v SizeValue) Type() string   { return "size" }
+func (v *SizeValue) Set(s string) error {
+	size, err := ParseSize(s)
+	*v = SizeValue(size)
+	return err
+}
+
+func ParseSize(s string) (size int64, err error) {
+	num := strings.TrimSuffix(strings.TrimSuffix(s, "B"), "i")
+	var shift uint
+	if n := len(num); n > 0 {
+		if i := strings.IndexByte("KMGT", num[n-1]&^0x20); i >= 0 {
+			shift = uint(i+1) * 10
+			num = num[:n-1]
+		}
+	}
+	size, err = strconv.ParseInt(num, 10, 64)
+	if err != nil || size < 0 || size > math.MaxInt64>>shift {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return size << shift, nil
+}
+
+// PatternListValue adds a pattern to the list, or patterns from a file if
+// FromFile is set, so that patterns from different options keep their order.
+type PatternListValue struct {
+	List     *PatternList
+	FromFile bool
+}
+
+func (v *PatternListValue) String() string { return "" }
+func (v *PatternListValue) Type() string   { return "pattern" }
+func (v *PatternListValue) Set(s string) error {
+	if v.FromFile {
+		return v.List.AddFromFile(s)
+	}
+	v.List.Add(s)
+	return nil
+}
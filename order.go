@@ -0,0 +1,68 @@
+package main
+
+import (
+	"sort"
+)
+
+type orderedItem struct {
+	Seq   int
+	Key   string
+	Value interface{}
+}
+
+// Reorderer receives items tagged with sequence numbers in any order and
+// emits them in ascending sequence order, or sorted by key if Sort is set.
+type Reorderer struct {
+	Sort bool
+	Emit func(v interface{})
+
+	next    int
+	pending map[int]interface{}
+	sorted  []orderedItem
+}
+
+func (r *Reorderer) Put(seq int, key string, v interface{}) {
+	if r.Sort {
+		r.sorted = append(r.sorted, orderedItem{Seq: seq, Key: key, Value: v})
+		return
+	}
+	if r.pending == nil {
+		r.pending = make(map[int]interface{})
+	}
+	r.pending[seq] = v
+	for {
+		v, ok := r.pending[r.next]
+		if !ok {
+			return
+		}
+		delete(r.pending, r.next)
+		r.next++
+		r.Emit(v)
+	}
+}
+
+// Flush emits all remaining items. It must be called after the last Put.
+func (r *Reorderer) Flush() {
+	if r.Sort {
+		sort.Slice(r.sorted, func(i, j int) bool {
+			if r.sorted[i].Key != r.sorted[j].Key {
+				return r.sorted[i].Key < r.sorted[j].Key
+			}
+			return r.sorted[i].Seq < r.sorted[j].Seq
+		})
+		for _, item := range r.sorted {
+			r.Emit(item.Value)
+		}
+		r.sorted = nil
+		return
+	}
+	seqs := make([]int, 0, len(r.pending))
+	for seq := range r.pending {
+		seqs = append(seqs, seq)
+	}
+	sort.Ints(seqs)
+	for _, seq := range seqs {
+		r.Emit(r.pending[seq])
+	}
+	r.pending = nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/erinacio/sha256s/engine"
+	"github.com/erinacio/sha256s/hashsum"
+)
+
+const (
+	FormatText   = "text"
+	FormatJSON   = "json"
+	FormatNDJSON = "ndjson"
+)
+
+type hashRecord struct {
+	pathRecord
+	Algorithm string `json:"algorithm"`
+	Digest    string `json:"digest,omitempty"`
+	Size      *int64 `json:"size,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+type pathRecord struct {
+	Path       string `json:"path,omitempty"`
+	PathBase64 []byte `json:"path_base64,omitempty"`
+}
+
+// newPathRecord makes a record of a file name, which is stored base64 encoded
+// in path_base64 instead of path if it isn't valid UTF-8.
+func newPathRecord(name string) pathRecord {
+	if utf8.ValidString(name) {
+		return pathRecord{Path: name}
+	}
+	return pathRecord{PathBase64: []byte(name)}
+}
+
+// newHashRecord makes a record of a hash result.
+func newHashRecord(opt Options, result engine.Result) hashRecord {
+	rec := hashRecord{pathRecord: newPathRecord(result.Name), Algorithm: opt.Algo.Name}
+	if result.Err != nil {
+		rec.Error = errorMessage(result.Err)
+	} else {
+		size := result.Size
+		rec.Digest, rec.Size = hex.EncodeToString(result.Sum), &size
+	}
+	return rec
+}
+
+// outputName returns the name of a file as printed, with slash separators
+// unless --native-path is given.
+func outputName(opt Options, name string) string {
+	if opt.NativePath {
+		return name
+	}
+	return toUnixPath(name)
+}
+
+// escapeStatusName escapes a file name containing newlines for a status
+// line, like sha256sum does.
+func escapeStatusName(name string) string {
+	if strings.IndexByte(name, '\n') < 0 {
+		return name
+	}
+	name, _ = hashsum.EscapeName(name)
+	return `\` + name
+}
+
+// RecordWriter writes values as a JSON array, or as newline delimited JSON.
+type RecordWriter struct {
+	Out    io.Writer
+	NDJSON bool
+
+	count int
+}
+
+func (w *RecordWriter) Write(v interface{}) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+	if !w.NDJSON {
+		if w.count == 0 {
+			_, _ = io.WriteString(w.Out, "[\n")
+		} else {
+			_, _ = io.WriteString(w.Out, ",\n")
+		}
+		buf.Truncate(buf.Len() - 1)
+	}
+	w.count++
+	_, err := w.Out.Write(buf.Bytes())
+	return err
+}
+
+// Close ends the JSON array, it's a no-op for newline delimited JSON.
+func (w *RecordWriter) Close() (err error) {
+	if w.NDJSON {
+		return nil
+	}
+	if w.count == 0 {
+		_, err = io.WriteString(w.Out, "[]\n")
+	} else {
+		_, err = io.WriteString(w.Out, "\n]\n")
+	}
+	return
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+// Pattern is a gitignore-style glob pattern.
+//
+// A pattern without a slash, except a trailing one, matches the last path
+// element at any depth, otherwise it's anchored to the base directory. A
+// trailing slash makes it match only directories, and a leading '!' negates
+// it. "*", "?" and "[...]" match within a path element, a "**" element
+// matches any number of elements, and a trailing "/**" matches everything
+// inside a directory.
+type Pattern struct {
+	segments []string
+	negate   bool
+	dirOnly  bool
+}
+
+// ParsePattern parses a pattern, ok is false for blank and comment lines.
+func ParsePattern(line string) (p Pattern, ok bool) {
+	line = trimTrailingSpaces(line)
+	if line == "" || line[0] == '#' {
+		return p, false
+	}
+	if line[0] == '!' {
+		p.negate = true
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		p.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return p, false
+	}
+	if !strings.Contains(line, "/") {
+		line = "**/" + line
+	}
+	p.segments = strings.Split(strings.TrimPrefix(line, "/"), "/")
+	return p, true
+}
+
+// trimTrailingSpaces trims trailing spaces unless escaped with a backslash.
+func trimTrailingSpaces(line string) string {
+	end := len(line)
+	for end > 0 && line[end-1] == ' ' {
+		if end > 1 && line[end-2] == '\\' {
+			break
+		}
+		end--
+	}
+	return line[:end]
+}
+
+// Match reports whether a slash separated path relative to the base
+// directory matches.
+func (p Pattern) Match(rel string, isDir bool) bool {
+	if p.dirOnly && !isDir {
+		return false
+	}
+	return matchSegments(p.segments, strings.Split(rel, "/"))
+}
+
+func matchSegments(pattern, parts []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			if len(pattern) == 1 {
+				return len(parts) > 0
+			}
+			for i := 0; i <= len(parts); i++ {
+				if matchSegments(pattern[1:], parts[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(parts) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], parts[0]); !ok {
+			return false
+		}
+		pattern, parts = pattern[1:], parts[1:]
+	}
+	return len(parts) == 0
+}
+
+// PatternList is a list of patterns where the last matching one wins.
+type PatternList []Pattern
+
+// Match reports whether the last matching pattern is not negated.
+func (l PatternList) Match(rel string, isDir bool) bool {
+	excluded, _ := l.MatchLast(rel, isDir)
+	return excluded
+}
+
+// MatchLast is like Match, but also reports whether any pattern matches.
+func (l PatternList) MatchLast(rel string, isDir bool) (excluded bool, matched bool) {
+	for i := len(l) - 1; i >= 0; i-- {
+		if l[i].Match(rel, isDir) {
+			return !l[i].negate, true
+		}
+	}
+	return false, false
+}
+
+func (l *PatternList) Add(line string) {
+	if p, ok := ParsePattern(line); ok {
+		*l = append(*l, p)
+	}
+}
+
+// AddFromFile adds patterns from a file, one per line.
+func (l *PatternList) AddFromFile(name string) error {
+	file, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return l.AddFromReader(file)
+}
+
+func (l *PatternList) AddFromReader(r io.Reader) error {
+	scn := bufio.NewScanner(r)
+	for scn.Scan() {
+		l.Add(strings.TrimSuffix(scn.Text(), "\r"))
+	}
+	return scn.Err()
+}
+
+// Filter decides which paths under a command-line root are walked.
+type Filter struct {
+	Excludes PatternList // matching files and directories are skipped
+	Includes PatternList // if not empty, only matching files are hashed
+}
+
+func (f *Filter) Skip(rel string, isDir bool) bool {
+	if f == nil {
+		return false
+	}
+	if f.Excludes.Match(rel, isDir) {
+		return true
+	}
+	return !isDir && len(f.Includes) > 0 && !f.Includes.Match(rel, false)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPatternMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		rel     string
+		isDir   bool
+		match   bool
+	}{
+		{"*.log", "a.log", false, true},
+		{"*.log", "x/y/a.log", false, true},
+		{"*.log", "a.log/b", false, false},
+		{"/a.log", "a.log", false, true},
+		{"/a.log", "x/a.log", false, false},
+		{"x/*.log", "x/a.log", false, true},
+		{"x/*.log", "y/x/a.log", false, false},
+		{"x/*.log", "x/y/a.log", false, false},
+		{"build/", "build", true, true},
+		{"build/", "build", false, false},
+		{"build/", "x/build", true, true},
+		{"**/foo", "foo", false, true},
+		{"**/foo", "a/b/foo", false, true},
+		{"a/**/b", "a/b", false, true},
+		{"a/**/b", "a/x/y/b", false, true},
+		{"a/**", "a/x/y", false, true},
+		{"a/**", "a", true, false},
+		{"?.txt", "a.txt", false, true},
+		{"?.txt", "ab.txt", false, false},
+		{"[ab].txt", "b.txt", false, true},
+		{"[ab].txt", "c.txt", false, false},
+		{`trailing\ `, "trailing ", false, true},
+		{"trailing  ", "trailing", false, true},
+	}
+	for _, test := range tests {
+		p, ok := ParsePattern(test.pattern)
+		if !ok {
+			t.Errorf("ParsePattern(%q) failed", test.pattern)
+			continue
+		}
+		if got := p.Match(test.rel, test.isDir); got != test.match {
+			t.Errorf("%q.Match(%q, %v) = %v, want %v", test.pattern, test.rel, test.isDir, got, test.match)
+		}
+	}
+}
+
+func TestParsePatternSkipsBlankAndComments(t *testing.T) {
+	for _, line := range []string{"", "   ", "# comment", "!", "/"} {
+		if _, ok := ParsePattern(line); ok {
+			t.Errorf("ParsePattern(%q) ok, want skipped", line)
+		}
+	}
+}
+
+func TestPatternListLastMatchWins(t *testing.T) {
+	var l PatternList
+	if err := l.AddFromReader(strings.NewReader("*.log\r\n!keep.log\n# comment\nx/keep.log\n")); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		rel      string
+		excluded bool
+		matched  bool
+	}{
+		{"a.log", true, true},
+		{"keep.log", false, true},
+		{"y/keep.log", false, true},
+		{"x/keep.log", true, true},
+		{"a.txt", false, false},
+	}
+	for _, test := range tests {
+		excluded, matched := l.MatchLast(test.rel, false)
+		if excluded != test.excluded || matched != test.matched {
+			t.Errorf("MatchLast(%q) = %v, %v, want %v, %v", test.rel, excluded, matched, test.excluded, test.matched)
+		}
+	}
+}
+
+func TestFilterSkip(t *testing.T) {
+	f := &Filter{}
+	f.Excludes.Add("vendor/")
+	f.Includes.Add("*.go")
+	tests := []struct {
+		rel   string
+		isDir bool
+		skip  bool
+	}{
+		{"main.go", false, false},
+		{"README.md", false, true},
+		{"vendor", true, true},
+		{"pkg", true, false},
+		{"pkg/a.go", false, false},
+	}
+	for _, test := range tests {
+		if got := f.Skip(test.rel, test.isDir); got != test.skip {
+			t.Errorf("Skip(%q, %v) = %v, want %v", test.rel, test.isDir, got, test.skip)
+		}
+	}
+	if (*Filter)(nil).Skip("a", false) {
+		t.Error("nil filter skips files")
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/erinacio/sha256s/engine"
+)
+
+const progressInterval = 500 * time.Millisecond
+
+// stderrMu serializes the progress line and log messages on standard error.
+var stderrMu sync.Mutex
+
+// ProgressReporter shows the progress of an engine on standard error, and
+// writes it as newline delimited JSON events to another file.
+type ProgressReporter struct {
+	Progress *engine.Progress
+	Human    bool          // show a line on standard error
+	Redraw   bool          // redraw the line in place, only the final one is shown otherwise
+	Events   *RecordWriter // write events if not nil
+
+	start     time.Time
+	stop      chan struct{}
+	done      chan struct{}
+	logWriter io.Writer // restored by Stop
+}
+
+type progressEvent struct {
+	Files      int64            `json:"files"`
+	TotalFiles *int64           `json:"total_files,omitempty"`
+	Bytes      int64            `json:"bytes"`
+	TotalBytes *int64           `json:"total_bytes,omitempty"`
+	Rate       float64          `json:"bytes_per_second"`
+	ETA        *float64         `json:"eta_seconds,omitempty"`
+	Current    *progressCurrent `json:"current,omitempty"`
+	Done       bool             `json:"done,omitempty"`
+}
+
+type progressCurrent struct {
+	pathRecord
+	Size int64 `json:"size"`
+	Done int64 `json:"done"`
+}
+
+// startProgress starts reporting the progress of an engine as requested by
+// the options, it returns nil if no progress is requested.
+func startProgress(opt Options, p *engine.Progress) *ProgressReporter {
+	if p == nil {
+		return nil
+	}
+	r := &ProgressReporter{
+		Progress: p,
+		Human:    opt.Progress,
+		Redraw:   opt.Progress && isTerminal(os.Stderr),
+		start:    time.Now(),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	if opt.ProgressFD >= 0 {
+		file := os.NewFile(uintptr(opt.ProgressFD), fmt.Sprintf("fd %d", opt.ProgressFD))
+		if _, err := file.Stat(); err != nil {
+			logError(err)
+			os.Exit(1)
+		}
+		r.Events = &RecordWriter{Out: file, NDJSON: true}
+	}
+	if r.Redraw {
+		r.logWriter = log.Writer()
+		log.SetOutput(progressClearingWriter{r.logWriter})
+	}
+	go r.run()
+	return r
+}
+
+func (r *ProgressReporter) run() {
+	defer close(r.done)
+	ticker := time.NewTicker(progressInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.stop:
+			r.report(true)
+			return
+		case <-ticker.C:
+			r.report(false)
+		}
+	}
+}
+
+// Stop reports the final progress, and ends the progress line.
+func (r *ProgressReporter) Stop() {
+	if r == nil {
+		return
+	}
+	close(r.stop)
+	<-r.done
+	if r.Redraw {
+		log.SetOutput(r.logWriter)
+	}
+}
+
+func (r *ProgressReporter) report(done bool) {
+	s := r.Progress.Snapshot()
+	event := progressEvent{Files: s.Files, Bytes: s.Bytes, Done: done}
+	if elapsed := time.Since(r.start).Seconds(); elapsed > 0 {
+		event.Rate = float64(s.Bytes) / elapsed
+	}
+	if s.TotalKnown {
+		event.TotalFiles, event.TotalBytes = &s.TotalFiles, &s.TotalBytes
+		if event.Rate > 0 && !done {
+			eta := float64(s.TotalBytes-s.Bytes) / event.Rate
+			if eta < 0 {
+				eta = 0
+			}
+			event.ETA = &eta
+		}
+	}
+	if s.Current != "" && !done {
+		event.Current = &progressCurrent{pathRecord: newPathRecord(s.Current), Size: s.CurrentSize, Done: s.CurrentDone}
+	}
+	if r.Events != nil {
+		_ = r.Events.Write(event)
+	}
+	if r.Human && (r.Redraw || done) {
+		line := progressLine(event)
+		if r.Redraw {
+			line = "\r" + line + "\x1b[K"
+		}
+		if done {
+			line += "\n"
+		}
+		stderrMu.Lock()
+		_, _ = io.WriteString(os.Stderr, line)
+		stderrMu.Unlock()
+	}
+}
+
+// isTerminal reports whether a file is a terminal, or another character
+// device.
+func isTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+func progressLine(e progressEvent) string {
+	line := fmt.Sprintf("%d", e.Files)
+	if e.TotalFiles != nil {
+		line += fmt.Sprintf("/%d", *e.TotalFiles)
+	}
+	line += " " + iif(e.Files == 1 && e.TotalFiles == nil, "file", "files") + ", " + formatSize(e.Bytes)
+	if e.TotalBytes != nil {
+		line += "/" + formatSize(*e.TotalBytes)
+	}
+	line += ", " + formatSize(int64(e.Rate)) + "/s"
+	if e.ETA != nil {
+		line += ", ETA " + (time.Duration(*e.ETA) * time.Second).String()
+	}
+	if c := e.Current; c != nil {
+		line += ", " + c.Path
+		if c.Path == "" {
+			line += fmt.Sprintf("%q", c.PathBase64)
+		}
+		if c.Size > 0 {
+			line += fmt.Sprintf(" %d%%", c.Done*100/c.Size)
+		}
+	}
+	return line
+}
+
+// formatSize formats a byte size with a binary unit.
+func formatSize(size int64) string {
+	if size < 1<<10 {
+		return fmt.Sprintf("%d B", size)
+	}
+	units := []string{"KiB", "MiB", "GiB", "TiB"}
+	v, i := float64(size)/(1<<10), 0
+	for v >= 1<<10 && i < len(units)-1 {
+		v, i = v/(1<<10), i+1
+	}
+	return fmt.Sprintf("%.1f %s", v, units[i])
+}
+
+// progressClearingWriter clears the progress line before each log message,
+// which is redrawn at the next report.
+type progressClearingWriter struct {
+	w io.Writer
+}
+
+func (w progressClearingWriter) Write(p []byte) (n int, err error) {
+	stderrMu.Lock()
+	defer stderrMu.Unlock()
+	if _, err = w.w.Write(append([]byte("\r\x1b[K"), p...)); err != nil {
+		return
+	}
+	return len(p), nil
+}
+
+// prescanFiles adds the files to be hashed to the totals of a progress.
+func prescanFiles(opt Options, p *engine.Progress) {
+	jobCh := make(chan engine.Job)
+	go walkWorker(context.Background(), opt, jobCh)
+	for job := range jobCh {
+		var size int64
+		if job.Err == nil {
+			if info, err := os.Stat(job.Name); err == nil {
+				size = info.Size()
+			}
+		}
+		p.AddTotal(1, size)
+	}
+	p.SetTotalKnown()
+}
+
+// prescanManifests adds the files listed in checksum files to the totals of
+// a progress.  Standard input can't be read twice, so totals are left
+// unknown if it's one of the checksum files.
+func prescanManifests(opt Options, p *engine.Progress) {
+	for _, path := range opt.Paths {
+		if path == "-" {
+			return
+		}
+	}
+	for _, path := range opt.Paths {
+		entries, badLines, err := readManifest(opt, path, false)
+		p.AddTotal(badLines, 0)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			name := entry.Name
+			if !opt.NativePath {
+				name = fromUnixPath(name)
+			}
+			var size int64
+			if info, err := os.Stat(name); err == nil {
+				size = info.Size()
+			}
+			p.AddTotal(1, size)
+		}
+	}
+	p.SetTotalKnown()
+}
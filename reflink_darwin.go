@@ -0,0 +1,15 @@
+package main
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// reflink makes dst a copy of src sharing its extents, dst must not exist.
+func reflink(src, dst string) error {
+	if err := unix.Clonefile(src, dst, unix.CLONE_NOFOLLOW); err != nil {
+		return &os.PathError{Op: "clonefile", Path: dst, Err: err}
+	}
+	return nil
+}
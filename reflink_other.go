@@ -0,0 +1,12 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package main
+
+import (
+	"errors"
+)
+
+func reflink(src, dst string) error {
+	return errors.New("reflinks are not supported on this system")
+}
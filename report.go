@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+
+	"github.com/erinacio/sha256s/hashsum"
+)
+
+const (
+	ReportText = "text"
+	ReportJSON = "json"
+)
+
+// CheckReport is the machine-readable result of a check run.
+type CheckReport struct {
+	Entries   []CheckReportEntry  `json:"entries"`
+	Errors    []string            `json:"errors"`
+	Untracked []pathRecord        `json:"untracked,omitempty"`
+	Counters  CheckReportCounters `json:"counters"`
+}
+
+type CheckReportEntry struct {
+	Source string `json:"source"`
+	Line   int    `json:"line"`
+	pathRecord
+	Algorithm string `json:"algorithm,omitempty"`
+	Status    string `json:"status"` // ok, mismatch, missing, unreadable or malformed
+	Expected  string `json:"expected,omitempty"`
+	Actual    string `json:"actual,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+type CheckReportCounters struct {
+	BadLines   int64 `json:"bad_lines"`
+	BadFiles   int64 `json:"bad_files"`
+	Errors     int64 `json:"errors"`
+	Mismatches int64 `json:"mismatches"`
+	Untracked  int64 `json:"untracked"`
+}
+
+func (r *CheckReport) AddEntry(opt Options, result checkResult) {
+	entry := CheckReportEntry{
+		Source:    opt.Paths[result.ArgI],
+		Line:      result.Line,
+		Algorithm: result.Algo,
+	}
+	switch {
+	case result.Stat == "":
+		entry.Status = "malformed"
+	case result.Stat == "OK":
+		entry.Status = "ok"
+	case result.Stat == "FAILED":
+		entry.Status = "mismatch"
+	case os.IsNotExist(result.Err):
+		entry.Status = "missing"
+	default:
+		entry.Status = "unreadable"
+	}
+	if entry.Status != "malformed" {
+		entry.pathRecord = newPathRecord(result.Name)
+		entry.Expected = hex.EncodeToString(result.Expected)
+	}
+	if result.Actual != nil {
+		entry.Actual = hex.EncodeToString(result.Actual)
+	}
+	if e, ok := result.Err.(hashsum.BadLineError); ok {
+		entry.Error = e.Reason
+		if entry.Error == "" {
+			entry.Error = "improperly formatted checksum line"
+		}
+	} else if result.Err != nil {
+		entry.Error = errorMessage(result.Err)
+	}
+	r.Entries = append(r.Entries, entry)
+}
+
+func (r *CheckReport) AddError(err error) {
+	r.Errors = append(r.Errors, errorMessage(err))
+}
+
+func (r *CheckReport) Write(out io.Writer) error {
+	if r.Entries == nil {
+		r.Entries = []CheckReportEntry{}
+	}
+	if r.Errors == nil {
+		r.Errors = []string{}
+	}
+	enc := json.NewEncoder(out)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// Keys and signatures are in the format of OpenBSD signify, a line of
+// untrusted comment followed by a line of base64 encoded data, which starts
+// with the algorithm "Ed" and a random key number.  Detached signatures of
+// minisign, which adds a trusted comment and a signature of it, and may
+// sign a BLAKE2b hash of the message with the algorithm "ED", are verified
+// as well.
+const (
+	commentPrefix        = "untrusted comment: "
+	trustedCommentPrefix = "trusted comment: "
+	algoEd25519          = "Ed"
+	algoEd25519Hashed    = "ED"
+)
+
+// PublicKey is an Ed25519 public key, with the key number of signify and
+// minisign identifying it in signatures.
+type PublicKey struct {
+	KeyNum [8]byte
+	Key    ed25519.PublicKey
+}
+
+// SecretKey is an unencrypted Ed25519 secret key, with the key number of its
+// public key.
+type SecretKey struct {
+	KeyNum [8]byte
+	Key    ed25519.PrivateKey
+}
+
+var errBadSignature = errors.New("signature verification failed")
+
+func isBadSignature(err error) bool {
+	pe, ok := err.(*os.PathError)
+	return ok && pe.Err == errBadSignature
+}
+
+// GenerateKeys writes a new key pair to files, which must not exist.  The
+// secret key isn't encrypted, like with signify -n.  Neither file is written if
+// one of them exists, and the secret key is removed if the public key can't be
+// written.
+func GenerateKeys(pubPath, secPath string) (err error) {
+	for _, path := range []string{secPath, pubPath} {
+		if _, err = os.Lstat(path); err == nil {
+			return &os.PathError{Op: "open", Path: path, Err: os.ErrExist}
+		} else if !os.IsNotExist(err) {
+			return
+		}
+	}
+	pub, sec, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return
+	}
+	var keyNum [8]byte
+	if _, err = rand.Read(keyNum[:]); err != nil {
+		return
+	}
+	checksum := sha512.Sum512(sec)
+	var secData bytes.Buffer
+	secData.WriteString(algoEd25519 + "BK")
+	secData.Write(make([]byte, 4+16)) // no kdf rounds and salt
+	secData.Write(checksum[:8])
+	secData.Write(keyNum[:])
+	secData.Write(sec)
+	if err = writeNewFile(secPath, 0600, "signify secret key", secData.Bytes()); err != nil {
+		return
+	}
+	if err = writeNewFile(pubPath, 0644, "signify public key", append(append([]byte(algoEd25519), keyNum[:]...), pub...)); err != nil {
+		_ = os.Remove(secPath)
+	}
+	return
+}
+
+func writeNewFile(path string, perm os.FileMode, comment string, data []byte) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(encodeKeyFile(comment, data))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func encodeKeyFile(comment string, data []byte) []byte {
+	return []byte(commentPrefix + comment + "\n" + base64.StdEncoding.EncodeToString(data) + "\n")
+}
+
+// decodeKeyFile decodes the first two lines of a key or signature file, and
+// returns the rest.
+func decodeKeyFile(path string, content []byte) (data []byte, rest []byte, err error) {
+	lines := bytes.SplitN(content, []byte("\n"), 3)
+	if len(lines) < 2 || !bytes.HasPrefix(lines[0], []byte(commentPrefix)) {
+		return nil, nil, fmt.Errorf("%s: invalid comment line", path)
+	}
+	data, err = base64.StdEncoding.DecodeString(strings.TrimSuffix(string(lines[1]), "\r"))
+	if err != nil || len(data) < 2 {
+		return nil, nil, fmt.Errorf("%s: invalid base64 line", path)
+	}
+	if len(lines) == 3 {
+		rest = lines[2]
+	}
+	return data, rest, nil
+}
+
+// LoadPublicKey reads a public key file of signify or minisign.
+func LoadPublicKey(path string) (*PublicKey, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	data, _, err := decodeKeyFile(path, content)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) != 2+8+ed25519.PublicKeySize || string(data[:2]) != algoEd25519 {
+		return nil, fmt.Errorf("%s: not an Ed25519 public key", path)
+	}
+	key := &PublicKey{Key: ed25519.PublicKey(data[10:])}
+	copy(key.KeyNum[:], data[2:10])
+	return key, nil
+}
+
+// LoadSecretKey reads a secret key file of signify, which must not be
+// encrypted.
+func LoadSecretKey(path string) (*SecretKey, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	data, _, err := decodeKeyFile(path, content)
+	if err != nil {
+		return nil, err
+	}
+	// algorithm, kdf algorithm, kdf rounds, salt, checksum, key number, key
+	if len(data) != 2+2+4+16+8+8+ed25519.PrivateKeySize || string(data[:4]) != algoEd25519+"BK" {
+		return nil, fmt.Errorf("%s: not an Ed25519 secret key", path)
+	}
+	if !bytes.Equal(data[4:8], make([]byte, 4)) {
+		return nil, fmt.Errorf("%s: encrypted secret keys are not supported, generate one with signify -n", path)
+	}
+	key := &SecretKey{Key: ed25519.PrivateKey(data[40:])}
+	copy(key.KeyNum[:], data[32:40])
+	if checksum := sha512.Sum512(key.Key); !bytes.Equal(checksum[:8], data[24:32]) {
+		return nil, fmt.Errorf("%s: corrupt secret key", path)
+	}
+	return key, nil
+}
+
+// Sign returns a signature file of a message.
+func (k *SecretKey) Sign(msg []byte, pubName string) []byte {
+	data := append(append([]byte(algoEd25519), k.KeyNum[:]...), ed25519.Sign(k.Key, msg)...)
+	return encodeKeyFile("verify with "+pubName, data)
+}
+
+// Verify verifies a signature file of a message.
+func (k *PublicKey) Verify(msg []byte, path string, sigFile []byte) error {
+	data, rest, err := decodeKeyFile(path, sigFile)
+	if err != nil {
+		return err
+	}
+	if len(data) != 2+8+ed25519.SignatureSize {
+		return fmt.Errorf("%s: invalid signature", path)
+	}
+	if !bytes.Equal(data[2:10], k.KeyNum[:]) {
+		return fmt.Errorf("%s: signed with another key", path)
+	}
+	sig := data[10:]
+	switch string(data[:2]) {
+	case algoEd25519:
+	case algoEd25519Hashed:
+		sum := blake2b.Sum512(msg)
+		msg = sum[:]
+	default:
+		return fmt.Errorf("%s: unknown signature algorithm", path)
+	}
+	if !ed25519.Verify(k.Key, msg, sig) {
+		return &os.PathError{Op: "verify", Path: path, Err: errBadSignature}
+	}
+	if bytes.HasPrefix(rest, []byte(trustedCommentPrefix)) {
+		return k.verifyTrustedComment(path, sig, rest)
+	}
+	return nil
+}
+
+// verifyTrustedComment verifies the trusted comment of a minisign signature.
+func (k *PublicKey) verifyTrustedComment(path string, sig, rest []byte) error {
+	lines := bytes.SplitN(rest, []byte("\n"), 3)
+	if len(lines) < 2 {
+		return fmt.Errorf("%s: missing trusted comment signature", path)
+	}
+	comment := bytes.TrimSuffix(bytes.TrimPrefix(lines[0], []byte(trustedCommentPrefix)), []byte("\r"))
+	globalSig, err := base64.StdEncoding.DecodeString(strings.TrimSuffix(string(lines[1]), "\r"))
+	if err != nil || len(globalSig) != ed25519.SignatureSize {
+		return fmt.Errorf("%s: invalid trusted comment signature", path)
+	}
+	if !ed25519.Verify(k.Key, append(append([]byte{}, sig...), comment...), globalSig) {
+		return &os.PathError{Op: "verify", Path: path, Err: errBadSignature}
+	}
+	return nil
+}
+
+// verifyManifest verifies a checksum file with an embedded signature, or else
+// with the detached signature in sigPath, or PATH.sig if empty.  It returns
+// the content to be trusted, without the embedded signature.
+func verifyManifest(key *PublicKey, path string, content []byte, sigPath string) (msg []byte, err error) {
+	if bytes.HasPrefix(content, []byte(commentPrefix)) {
+		_, msg, err = decodeKeyFile(path, content)
+		if err != nil {
+			return
+		}
+		sigFile := content[:len(content)-len(msg)]
+		return msg, key.Verify(msg, path, sigFile)
+	}
+	if sigPath == "" {
+		if path == "-" {
+			return nil, errors.New("-: no embedded signature, and no --signature given")
+		}
+		sigPath = path + ".sig"
+	}
+	sigFile, err := ioutil.ReadFile(sigPath)
+	if err != nil {
+		return
+	}
+	return content, key.Verify(content, sigPath, sigFile)
+}
+
+// publicKeyName returns the name of the public key of a secret key, for the
+// comment of signatures.
+func publicKeyName(secPath string) string {
+	name := filepath.Base(secPath)
+	return strings.TrimSuffix(name, ".sec") + ".pub"
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// The fixtures are made with a key of the seed 0, 1, ..., 31 and the key
+// number 1, 2, ..., 8, in the formats written by signify and minisign.
+const (
+	testPublicKey = "untrusted comment: minisign public key 0807060504030201\n" +
+		"RWQBAgMEBQYHCAOhB7/zzhC+HXDdGOdLwJln5NYwm6UNXx3chmQSVTG4\n"
+	testMessage = "2d711642b726b04401627ca9fbac32f5c8530fb1903cc4db02258717921a4881  a\n"
+
+	// signify -S -e
+	testEmbedded = "untrusted comment: verify with test.pub\n" +
+		"RWQBAgMEBQYHCPReHNEYuDyTlEihLJ5iKy109BQrkNC8AN9A4mAJdDJuT7xn61VYdiujUh0V76EFHgW/6JKA2kUG9uZqncMTPwQ=\n" +
+		testMessage
+
+	// minisign -S -H, signing a BLAKE2b hash with a trusted comment
+	testMinisign = "untrusted comment: signature from minisign secret key\n" +
+		"RUQBAgMEBQYHCGhG9sl0f9Z79hjzQSuGlESSJYno127cXZj5Gz45aQf5hG6jxKxounZvSUeMF8O/IYfS6gIrC/pESapWH06fFQM=\n" +
+		"trusted comment: timestamp:1700000000\tfile:SHA256SUMS\thashed\n" +
+		"dtCED1aIwdHoSRgS86rpzfTF600pUEVYVHBFhbFb/a5RsQDcExHuuDUNQKzyr/wFNZ+N9ntza6ciUSI6adxdAQ==\n"
+)
+
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func generateTestKeys(t *testing.T, dir, name string) (*PublicKey, *SecretKey) {
+	t.Helper()
+	pubPath, secPath := filepath.Join(dir, name+".pub"), filepath.Join(dir, name+".sec")
+	if err := GenerateKeys(pubPath, secPath); err != nil {
+		t.Fatal(err)
+	}
+	pub, err := LoadPublicKey(pubPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sec, err := LoadSecretKey(secPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pub, sec
+}
+
+func TestSignifyRoundTrip(t *testing.T) {
+	pub, sec := generateTestKeys(t, t.TempDir(), "key")
+	sig := sec.Sign([]byte(testMessage), "key.pub")
+	if !strings.HasPrefix(string(sig), "untrusted comment: verify with key.pub\n") {
+		t.Errorf("Sign() = %q, want the comment of signify", sig)
+	}
+	if err := pub.Verify([]byte(testMessage), "sig", sig); err != nil {
+		t.Errorf("Verify() = %v", err)
+	}
+	msg, err := verifyManifest(pub, "SUMS", append(sig, testMessage...), "")
+	if err != nil || string(msg) != testMessage {
+		t.Errorf("verifyManifest() = %q, %v, want %q", msg, err, testMessage)
+	}
+}
+
+func TestSignifyTampered(t *testing.T) {
+	pub, sec := generateTestKeys(t, t.TempDir(), "key")
+	sig := sec.Sign([]byte(testMessage), "key.pub")
+	tampered := strings.Replace(testMessage, "2d7", "3d7", 1)
+	if err := pub.Verify([]byte(tampered), "sig", sig); !isBadSignature(err) {
+		t.Errorf("Verify() of a tampered message = %v, want a bad signature", err)
+	}
+	if _, err := verifyManifest(pub, "SUMS", append(sig, tampered...), ""); !isBadSignature(err) {
+		t.Errorf("verifyManifest() of a tampered message = %v, want a bad signature", err)
+	}
+}
+
+func TestSignifyWrongKeyNum(t *testing.T) {
+	dir := t.TempDir()
+	pub, _ := generateTestKeys(t, dir, "a")
+	_, other := generateTestKeys(t, dir, "b")
+	sig := other.Sign([]byte(testMessage), "b.pub")
+	if err := pub.Verify([]byte(testMessage), "sig", sig); err == nil || !strings.Contains(err.Error(), "another key") {
+		t.Errorf("Verify() with another key = %v, want signed with another key", err)
+	}
+}
+
+func TestGenerateKeysExisting(t *testing.T) {
+	dir := t.TempDir()
+	pubPath, secPath := filepath.Join(dir, "key.pub"), filepath.Join(dir, "key.sec")
+	writeTestFile(t, pubPath, "")
+	if err := GenerateKeys(pubPath, secPath); !os.IsExist(err) {
+		t.Errorf("GenerateKeys() = %v, want an existing file error", err)
+	}
+	if _, err := os.Stat(secPath); !os.IsNotExist(err) {
+		t.Errorf("secret key written although the public key exists: %v", err)
+	}
+}
+
+func TestVerifyFixtures(t *testing.T) {
+	dir := t.TempDir()
+	pubPath := filepath.Join(dir, "test.pub")
+	writeTestFile(t, pubPath, testPublicKey)
+	pub, err := LoadPublicKey(pubPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := verifyManifest(pub, "SUMS", []byte(testEmbedded), "")
+	if err != nil || string(msg) != testMessage {
+		t.Errorf("verifyManifest() of signify -e = %q, %v, want %q", msg, err, testMessage)
+	}
+
+	sumsPath := filepath.Join(dir, "SHA256SUMS")
+	writeTestFile(t, sumsPath, testMessage)
+	writeTestFile(t, sumsPath+".minisig", testMinisign)
+	if _, err := verifyManifest(pub, sumsPath, []byte(testMessage), sumsPath+".minisig"); err != nil {
+		t.Errorf("verifyManifest() of minisign = %v", err)
+	}
+
+	tampered := strings.Replace(testMinisign, "hashed", "HASHED", 1)
+	writeTestFile(t, sumsPath+".minisig", tampered)
+	if _, err := verifyManifest(pub, sumsPath, []byte(testMessage), sumsPath+".minisig"); !isBadSignature(err) {
+		t.Errorf("verifyManifest() of a tampered trusted comment = %v, want a bad signature", err)
+	}
+}
+
+func TestSignedManifestRejected(t *testing.T) {
+	dir := t.TempDir()
+	embedded, detached := filepath.Join(dir, "EMBEDDED"), filepath.Join(dir, "DETACHED")
+	writeTestFile(t, embedded, testEmbedded)
+	writeTestFile(t, detached, testMessage)
+	writeTestFile(t, detached+".sig", testEmbedded[:len(testEmbedded)-len(testMessage)])
+
+	var opt Options
+	if err := opt.Parse([]string{"--diff", embedded, detached}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := readManifest(opt, embedded, false); err == nil {
+		t.Error("readManifest() of a signed checksum file succeeded")
+	}
+	opt = Options{}
+	if err := opt.Parse([]string{"-c", "--public-key=test.pub", embedded}); err != nil {
+		t.Fatal(err)
+	}
+	entries, _, err := readManifest(opt, embedded, false)
+	if err != nil || len(entries) != 1 || entries[0].Name != "a" {
+		t.Errorf("readManifest() with --public-key = %v, %v, want the entry of a", entries, err)
+	}
+
+	opt = Options{}
+	if err := opt.Parse([]string{"--update=" + detached, dir}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := updateManifest(context.Background(), opt); ok {
+		t.Error("updateManifest() of a checksum file with a detached signature succeeded")
+	}
+	if content, err := os.ReadFile(detached); err != nil || string(content) != testMessage {
+		t.Errorf("checksum file with a detached signature changed to %q, %v", content, err)
+	}
+}
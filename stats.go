@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/erinacio/sha256s/engine"
+	"github.com/erinacio/sha256s/hashsum"
+)
+
+// RunStats collects the summary of a run printed by --stats.  A nil RunStats
+// collects nothing.
+type RunStats struct {
+	Top int // number of slowest files kept
+
+	start   time.Time
+	files   int64
+	bytes   int64
+	workers []workerStats
+	slowest []engine.Result // sorted by duration, slowest first
+	errors  map[string]int64
+}
+
+type workerStats struct {
+	Files int64
+	Bytes int64
+	Busy  time.Duration
+}
+
+// newRunStats returns the stats requested by the options, or nil.
+func newRunStats(opt Options) *RunStats {
+	if opt.Stats <= 0 {
+		return nil
+	}
+	return &RunStats{
+		Top:     opt.Stats,
+		start:   time.Now(),
+		workers: make([]workerStats, opt.Jobs),
+		errors:  make(map[string]int64),
+	}
+}
+
+// Add counts a hashed file, failed jobs are counted by AddError instead.
+func (s *RunStats) Add(result engine.Result) {
+	if s == nil || result.Err != nil {
+		return
+	}
+	s.files++
+	s.bytes += result.Size
+	if result.Worker < len(s.workers) {
+		w := &s.workers[result.Worker]
+		w.Files++
+		w.Bytes += result.Size
+		w.Busy += result.Duration
+	}
+	i := sort.Search(len(s.slowest), func(i int) bool { return s.slowest[i].Duration < result.Duration })
+	if i < s.Top {
+		result.Sum, result.Info, result.Data = nil, nil, nil
+		s.slowest = append(s.slowest, engine.Result{})
+		copy(s.slowest[i+1:], s.slowest[i:])
+		s.slowest[i] = result
+		if len(s.slowest) > s.Top {
+			s.slowest = s.slowest[:s.Top]
+		}
+	}
+}
+
+// AddError counts an error by its category.
+func (s *RunStats) AddError(err error) {
+	if s == nil {
+		return
+	}
+	s.errors[errorCategory(err)]++
+}
+
+// Count counts a failure which isn't an error, such as a mismatch.
+func (s *RunStats) Count(category string) {
+	if s == nil {
+		return
+	}
+	s.errors[category]++
+}
+
+func errorCategory(err error) string {
+	switch err.(type) {
+	case hashsum.BadLineError:
+		return "improperly formatted"
+	case *LoopError:
+		return "directory loop"
+	}
+	switch {
+	case isBadSignature(err):
+		return "bad signature"
+	case os.IsNotExist(err):
+		return "not found"
+	case os.IsPermission(err):
+		return "permission denied"
+	default:
+		return "other"
+	}
+}
+
+// Report logs the summary.
+func (s *RunStats) Report() {
+	if s == nil {
+		return
+	}
+	wall := time.Since(s.start)
+	log.Printf("%d %s, %s in %.3fs, %s/s", s.files, iif(s.files == 1, "file", "files"),
+		formatSize(s.bytes), wall.Seconds(), formatSize(throughput(s.bytes, wall)))
+	if len(s.workers) > 1 {
+		for i, w := range s.workers {
+			log.Printf("job %d: %d %s, %s in %.3fs busy, %s/s", i+1, w.Files, iif(w.Files == 1, "file", "files"),
+				formatSize(w.Bytes), w.Busy.Seconds(), formatSize(throughput(w.Bytes, w.Busy)))
+		}
+	}
+	for _, result := range s.slowest {
+		log.Printf("slow: %s, %s in %.3fs", escapeStatusName(result.Name), formatSize(result.Size), result.Duration.Seconds())
+	}
+	if len(s.errors) > 0 {
+		categories := make([]string, 0, len(s.errors))
+		for category := range s.errors {
+			categories = append(categories, category)
+		}
+		sort.Strings(categories)
+		for i, category := range categories {
+			categories[i] = fmt.Sprintf("%d %s", s.errors[category], category)
+		}
+		log.Printf("errors: %s", strings.Join(categories, ", "))
+	}
+}
+
+func throughput(bytes int64, d time.Duration) int64 {
+	if d <= 0 {
+		return 0
+	}
+	return int64(float64(bytes) / d.Seconds())
+}
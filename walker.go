@@ -1,92 +1,247 @@
 package main
 
 import (
-	"errors"
-	"io"
 	"os"
 	"path/filepath"
-	"strings"
+	"sort"
+	"sync"
+
+	"github.com/erinacio/sha256s/engine"
 )
 
 type WalkFunc func(name string, err error)
 
-type statFunc func(name string) (info os.FileInfo, err error)
+// Walker finds regular files under command-line roots.  Up to Jobs-1
+// directories are read ahead by other goroutines and kept until walked, but
+// files are always passed to the WalkFunc in sorted depth-first order, from
+// the calling goroutine.
+type Walker struct {
+	Dereference bool    // follow symbolic links below command-line roots
+	Filter      *Filter // applied to paths relative to each root
+	Jobs        int     // number of directories read at once, 1 if not positive
+
+	// IgnoreFiles are names of gitignore-style files read in each directory,
+	// if not empty, .git directories are skipped as well.
+	IgnoreFiles []string
+
+	OneFileSystem bool // don't descend into directories on other devices
+	MinDepth      int  // skip files above this depth, the root is at depth 0
+	MaxDepth      int  // don't descend below this depth, unlimited if negative
+	Verbose       bool // report skipped mount points as SkippedError
+
+	sem chan struct{} // held by directories read ahead until they're walked
+}
+
+// SkippedError reports a skipped path, it isn't a failure.
+type SkippedError struct {
+	Path   string
+	Reason string
+}
+
+func (e *SkippedError) Error() string { return e.Path + ": " + e.Reason }
+
+// LoopError reports a directory which is the same as one of its ancestors,
+// reached through a symbolic link or a bind mount.
+type LoopError struct {
+	Path   string
+	Target string // the ancestor
+}
+
+func (e *LoopError) Error() string {
+	return e.Path + ": directory loop detected, same directory as " + e.Target
+}
+
+func isSkipped(err error) bool {
+	_, ok := err.(*SkippedError)
+	return ok
+}
+
+// walkState is the state of a directory being walked.
+type walkState struct {
+	rel    string       // slash separated path relative to the command-line root
+	depth  int          // 0 for the command-line root
+	dev    uint64       // device of the command-line root
+	ignore *ignoreLevel // ignore patterns of the parent directory
+	dirs   *dirChain    // the directory and its ancestors
+}
+
+// dirChain is a directory on the current recursion path.
+type dirChain struct {
+	path   string
+	info   os.FileInfo
+	parent *dirChain
+}
+
+// find returns the directory or ancestor which is the same file as info,
+// comparing device and inode numbers.
+func (c *dirChain) find(info os.FileInfo) *dirChain {
+	for ; c != nil; c = c.parent {
+		if os.SameFile(c.info, info) {
+			return c
+		}
+	}
+	return nil
+}
 
-func FindRegularFiles(path string, statFn statFunc, walkFn WalkFunc) {
+// walkDir is a directory read once, either ahead or when it's walked.
+type walkDir struct {
+	path   string
+	st     walkState
+	once   sync.Once
+	events []walkEvent
+	ahead  bool // holds a slot of the semaphore
+}
+
+// walkEvent is a file or error to pass to the WalkFunc, or a subdirectory
+// to walk if dir is not nil.
+type walkEvent struct {
+	path string
+	err  error
+	dir  *walkDir
+}
+
+func (w *Walker) FindRegularFiles(path string, walkFn WalkFunc) {
 	info, err := os.Stat(path) // intentionally
 	if err != nil {
 		walkFn(path, err)
 		return
 	}
 	if mode := info.Mode(); mode.IsRegular() {
-		walkFn(path, nil)
-	} else if mode.IsDir() {
-		findRegularFilesInDir(path, statFn, walkFn)
+		if w.MinDepth <= 0 {
+			walkFn(path, nil)
+		}
+	} else if mode.IsDir() && w.MaxDepth != 0 {
+		if w.sem == nil && w.Jobs > 1 {
+			w.sem = make(chan struct{}, w.Jobs-1)
+		}
+		id, _ := engine.FileIdentity(info)
+		st := walkState{dev: id.Dev, dirs: &dirChain{path: path, info: info}}
+		w.walk(&walkDir{path: path, st: st}, walkFn)
 	}
 }
 
-func findRegularFilesInDir(root string, statFn statFunc, walkFn WalkFunc) {
-	file, err := os.Open(root)
-	if err != nil {
-		walkFn(root, err)
-		return
+func (w *Walker) walk(d *walkDir, walkFn WalkFunc) {
+	d.once.Do(func() { w.read(d) })
+	events := d.events
+	d.events = nil
+	if d.ahead {
+		<-w.sem
 	}
-	defer file.Close()
+	for _, ev := range events {
+		if ev.dir != nil {
+			w.walk(ev.dir, walkFn)
+		} else {
+			walkFn(ev.path, ev.err)
+		}
+	}
+}
 
-	for {
-		names, err := file.Readdirnames(128)
-		if err != nil {
-			if err != io.EOF {
-				walkFn(root, err)
-			}
-			return
+// readAhead reads a directory in another goroutine if a slot is available.
+// The slot is released when the directory is walked, so that the events of
+// directories read ahead don't pile up in memory.
+func (w *Walker) readAhead(d *walkDir) {
+	select {
+	case w.sem <- struct{}{}:
+		d.ahead = true
+		go d.once.Do(func() { w.read(d) })
+	default:
+	}
+}
+
+// read turns the entries of a directory into events.  File types come from
+// the directory itself where the platform provides them, so only symbolic
+// links being followed and directories are stat'ed.
+func (w *Walker) read(d *walkDir) {
+	emit := func(path string, err error) {
+		d.events = append(d.events, walkEvent{path: path, err: err})
+	}
+	entries, err := readDir(d.path)
+	if err != nil {
+		emit(d.path, err)
+	}
+	st := d.st
+	if len(w.IgnoreFiles) > 0 {
+		if st.ignore, err = loadIgnoreLevel(d.path, st.rel, w.IgnoreFiles, st.ignore); err != nil {
+			emit(d.path, err)
+		}
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		path := filepath.Join(d.path, name)
+		sub := walkState{rel: name, depth: st.depth + 1, dev: st.dev, ignore: st.ignore}
+		if st.rel != "" {
+			sub.rel = st.rel + "/" + name
 		}
-		for _, name := range names {
-			path := filepath.Join(root, name)
-			looping, err := isLooping(path)
-			if err != nil {
-				walkFn(path, err)
+		mode := entry.Type()
+		var info os.FileInfo
+		if mode&os.ModeSymlink != 0 {
+			if !w.Dereference {
 				continue
 			}
-			if looping {
-				walkFn(path, &os.PathError{Op: "stat", Path: path, Err: errors.New("symlink loop detected")})
+			if info, err = os.Stat(path); err != nil {
+				emit(path, err)
 				continue
 			}
-			info, err := statFn(path)
-			if err != nil {
-				walkFn(path, err)
+			mode = info.Mode()
+		}
+		if mode.IsRegular() {
+			if sub.depth >= w.MinDepth && !w.skip(sub.rel, false, st.ignore) {
+				emit(path, nil)
+			}
+		} else if mode.IsDir() {
+			if (w.MaxDepth >= 0 && sub.depth >= w.MaxDepth) || w.skip(sub.rel, true, st.ignore) {
 				continue
 			}
-			if mode := info.Mode(); mode.IsRegular() {
-				walkFn(path, nil)
-			} else if mode.IsDir() {
-				findRegularFilesInDir(path, statFn, walkFn)
+			if info == nil {
+				if info, err = entry.Info(); err != nil {
+					emit(path, err)
+					continue
+				}
 			}
+			if id, ok := engine.FileIdentity(info); ok && w.OneFileSystem && id.Dev != st.dev {
+				if w.Verbose {
+					emit(path, &SkippedError{Path: path, Reason: "skipping mount point"})
+				}
+				continue
+			}
+			if target := st.dirs.find(info); target != nil {
+				emit(path, &LoopError{Path: path, Target: target.path})
+				continue
+			}
+			sub.dirs = &dirChain{path: path, info: info, parent: st.dirs}
+			d.events = append(d.events, walkEvent{dir: &walkDir{path: path, st: sub}})
 		}
 	}
+	for _, ev := range d.events {
+		if ev.dir != nil {
+			w.readAhead(ev.dir)
+		}
+	}
+}
+
+func (w *Walker) skip(rel string, isDir bool, ignore *ignoreLevel) bool {
+	if w.Filter.Skip(rel, isDir) {
+		return true
+	}
+	if len(w.IgnoreFiles) == 0 {
+		return false
+	}
+	if isDir && filepath.Base(rel) == ".git" {
+		return true
+	}
+	return ignore.Ignored(rel, isDir)
 }
 
-func isLooping(path string) (looping bool, err error) {
-	absPath, err := filepath.Abs(path)
+// readDir returns the entries of a directory sorted by name, so that the
+// traversal order doesn't depend on the file system.  Entries read before an
+// error are returned along with the error.
+func readDir(dir string) (entries []os.DirEntry, err error) {
+	file, err := os.Open(dir)
 	if err != nil {
 		return
 	}
-	visitedSet := make(map[string]struct{}, strings.Count(path, string(filepath.Separator)))
-	for {
-		var realPath, file string
-		realPath, err = filepath.EvalSymlinks(absPath)
-		if err != nil {
-			return
-		}
-		_, looping = visitedSet[realPath]
-		if looping {
-			return
-		}
-		visitedSet[realPath] = struct{}{}
-		absPath, file = filepath.Split(absPath)
-		if file == "" {
-			return
-		}
-		absPath = filepath.Clean(absPath)
-	}
+	entries, err = file.ReadDir(-1)
+	_ = file.Close()
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return
 }
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/erinacio/sha256s/engine"
+)
+
+func TestWalkerLoopDetection(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{"a/b", "c"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, file := range []string{"a/b/f", "c/g"} {
+		if err := os.WriteFile(filepath.Join(root, file), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// a/b/up points back to a, and a/c to a sibling, which isn't a loop
+	if err := os.Symlink("..", filepath.Join(root, "a/b/up")); err != nil {
+		t.Skip("symbolic links unsupported:", err)
+	}
+	if err := os.Symlink("../c", filepath.Join(root, "a/c")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, jobs := range []int{1, 4} {
+		var files []string
+		var loops []*LoopError
+		w := Walker{Dereference: true, Jobs: jobs, MaxDepth: -1}
+		w.FindRegularFiles(root, func(name string, err error) {
+			if loop, ok := err.(*LoopError); ok {
+				loops = append(loops, loop)
+			} else if err != nil {
+				t.Errorf("jobs %d: unexpected error %v", jobs, err)
+			} else {
+				rel, _ := filepath.Rel(root, name)
+				files = append(files, filepath.ToSlash(rel))
+			}
+		})
+		want := []string{"a/b/f", "a/c/g", "c/g"}
+		if !reflect.DeepEqual(files, want) {
+			t.Errorf("jobs %d: files = %q, want %q", jobs, files, want)
+		}
+		if len(loops) != 1 || loops[0].Path != filepath.Join(root, "a/b/up") || loops[0].Target != filepath.Join(root, "a") {
+			t.Errorf("jobs %d: loops = %v, want a/b/up to a", jobs, loops)
+		}
+	}
+}
+
+func TestWalkerNoDereferenceIgnoresLinks(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "f"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(".", filepath.Join(root, "self")); err != nil {
+		t.Skip("symbolic links unsupported:", err)
+	}
+	var count int
+	w := Walker{MaxDepth: -1}
+	w.FindRegularFiles(root, func(name string, err error) {
+		if err != nil {
+			t.Errorf("unexpected error %v", err)
+		}
+		count++
+	})
+	if count != 1 {
+		t.Errorf("found %d files, want 1", count)
+	}
+}
+
+func TestJobSourcesStopOnCancel(t *testing.T) {
+	root := t.TempDir()
+	var sums strings.Builder
+	for i := 0; i < 10; i++ {
+		name := filepath.Join(root, fmt.Sprint(i))
+		if err := os.WriteFile(name, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		fmt.Fprintf(&sums, "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855  %s\n", name)
+	}
+	manifest := filepath.Join(t.TempDir(), "SUMS")
+	if err := os.WriteFile(manifest, []byte(sums.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	sources := map[string]struct {
+		args []string
+		run  func(ctx context.Context, opt Options, jobCh chan<- engine.Job)
+	}{
+		"walkWorker":    {[]string{"-r", root}, walkWorker},
+		"readSumWorker": {[]string{"-c", manifest}, func(ctx context.Context, opt Options, jobCh chan<- engine.Job) { readSumWorker(ctx, opt, nil, jobCh) }},
+	}
+	for name, source := range sources {
+		var opt Options
+		if err := opt.Parse(source.args); err != nil {
+			t.Fatal(err)
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		jobCh := make(chan engine.Job)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			source.run(ctx, opt, jobCh)
+		}()
+		<-jobCh
+		cancel()
+		// the source must return without anyone receiving the other jobs
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Errorf("%s: still sending after cancel", name)
+		}
+	}
+}
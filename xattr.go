@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/erinacio/sha256s/hashsum"
+)
+
+// Checksums are stored in extended attributes following the convention of
+// shatag, e.g. user.shatag.sha256 for the hex digest, and user.shatag.ts for
+// the modification time of the file when it was hashed.
+const (
+	xattrPrefix    = "user.shatag."
+	xattrTimestamp = xattrPrefix + "ts"
+)
+
+var errNoStoredChecksum = errors.New("no stored checksum")
+
+func xattrName(algo hashsum.Algorithm) string {
+	return xattrPrefix + strings.ToLower(algo.Name)
+}
+
+func StoreXattrSum(path string, algo hashsum.Algorithm, sum []byte, mtime time.Time) error {
+	ts := fmt.Sprintf("%d.%09d", mtime.Unix(), mtime.Nanosecond())
+	if err := setXattr(path, xattrTimestamp, []byte(ts)); err != nil {
+		return &os.PathError{Op: "setxattr", Path: path, Err: err}
+	}
+	if err := setXattr(path, xattrName(algo), []byte(hex.EncodeToString(sum))); err != nil {
+		return &os.PathError{Op: "setxattr", Path: path, Err: err}
+	}
+	return nil
+}
+
+// LoadXattrSum loads the stored checksum and its timestamp, err is
+// errNoStoredChecksum if there is none.
+func LoadXattrSum(path string, algo hashsum.Algorithm) (sum []byte, ts string, err error) {
+	value, err := getXattr(path, xattrName(algo))
+	if isNoXattr(err) {
+		return nil, "", errNoStoredChecksum
+	} else if err != nil {
+		return nil, "", &os.PathError{Op: "getxattr", Path: path, Err: err}
+	}
+	sum, err = hex.DecodeString(strings.TrimSpace(string(value)))
+	if err != nil || len(sum) != algo.Size {
+		return nil, "", fmt.Errorf("%s: improperly formatted %s attribute", path, xattrName(algo))
+	}
+	value, err = getXattr(path, xattrTimestamp)
+	if err != nil && !isNoXattr(err) {
+		return nil, "", &os.PathError{Op: "getxattr", Path: path, Err: err}
+	}
+	return sum, strings.TrimSpace(string(value)), nil
+}
+
+// xattrTimestampMatches compares a stored timestamp with a modification time,
+// at the precision of the stored timestamp.
+func xattrTimestampMatches(ts string, mtime time.Time) bool {
+	secPart, fracPart := ts, ""
+	if i := strings.IndexByte(ts, '.'); i >= 0 {
+		secPart, fracPart = ts[:i], ts[i+1:]
+	}
+	sec, err := strconv.ParseInt(secPart, 10, 64)
+	if err != nil || sec != mtime.Unix() || len(fracPart) > 9 {
+		return false
+	}
+	if fracPart == "" {
+		return true
+	}
+	frac, err := strconv.ParseInt(fracPart, 10, 64)
+	if err != nil {
+		return false
+	}
+	nsec := int64(mtime.Nanosecond())
+	for i := len(fracPart); i < 9; i++ {
+		nsec /= 10
+	}
+	return frac == nsec
+}
@@ -0,0 +1,9 @@
+package main
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+func isNoXattr(err error) bool {
+	return err == unix.ENODATA
+}
@@ -0,0 +1,22 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package main
+
+import (
+	"errors"
+)
+
+var errXattrUnsupported = errors.New("extended attributes are not supported on this system")
+
+func setXattr(path string, name string, value []byte) error {
+	return errXattrUnsupported
+}
+
+func getXattr(path string, name string) (value []byte, err error) {
+	return nil, errXattrUnsupported
+}
+
+func isNoXattr(err error) bool {
+	return false
+}
@@ -0,0 +1,26 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package main
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+func setXattr(path string, name string, value []byte) error {
+	return unix.Setxattr(path, name, value, 0)
+}
+
+func getXattr(path string, name string) (value []byte, err error) {
+	value = make([]byte, 128)
+	for {
+		n, err := unix.Getxattr(path, name, value)
+		if err == unix.ERANGE {
+			value = make([]byte, len(value)*2)
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		return value[:n], nil
+	}
+}